@@ -0,0 +1,41 @@
+package nsq
+
+import "io"
+
+// Codec abstracts the wire framing Conn speaks to nsqd: the handshake
+// negotiated immediately after dialing, and how frames are read off the
+// connection afterward. Conn defaults to protocolV2Codec (nsqd's existing
+// MagicV2 handshake plus ReadResponse/UnpackResponse framing); a different
+// Codec can be set before Connect to speak an alternative framing (e.g. a
+// length-prefixed test fixture), or to swap in a future magic version,
+// without changing readLoop itself.
+//
+// TLS/Deflate/Snappy upgrades remain a transport-level concern handled by
+// upgradeTLS/upgradeDeflate/upgradeSnappy, which swap the io.Reader/Writer
+// a Codec reads frames from and writes commands to - the Codec only cares
+// about framing, not what stream of bytes it's framing.
+type Codec interface {
+	// Negotiate writes whatever handshake bytes the wire protocol
+	// requires, before IDENTIFY is sent.
+	Negotiate(w io.Writer) error
+
+	// ReadFrame reads one frame from r, returning its type and payload.
+	ReadFrame(r io.Reader) (frameType int32, data []byte, err error)
+}
+
+// protocolV2Codec is the default Codec, speaking nsqd's existing V2 binary
+// protocol unchanged.
+type protocolV2Codec struct{}
+
+func (protocolV2Codec) Negotiate(w io.Writer) error {
+	_, err := w.Write(MagicV2)
+	return err
+}
+
+func (protocolV2Codec) ReadFrame(r io.Reader) (int32, []byte, error) {
+	resp, err := ReadResponse(r)
+	if err != nil {
+		return -1, nil, err
+	}
+	return UnpackResponse(resp)
+}
@@ -0,0 +1,163 @@
+package nsq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+var byteSpace = []byte(" ")
+var byteNewLine = []byte("\n")
+
+// Command is a single NSQ TCP protocol command: a name, zero or more
+// space-separated parameters, and an optional size-prefixed body.
+type Command struct {
+	Name   []byte
+	Params [][]byte
+	Body   []byte
+}
+
+// String returns the name and params of c, for logging.
+func (c *Command) String() string {
+	if len(c.Params) > 0 {
+		return string(c.Name) + " " + string(bytes.Join(c.Params, byteSpace))
+	}
+	return string(c.Name)
+}
+
+// Write serializes c onto w according to the NSQ TCP protocol spec:
+// <name> (<space> <param>)* <newline> [<4-byte size><body>]
+func (c *Command) Write(w io.Writer) error {
+	if _, err := w.Write(c.Name); err != nil {
+		return err
+	}
+	for _, param := range c.Params {
+		if _, err := w.Write(byteSpace); err != nil {
+			return err
+		}
+		if _, err := w.Write(param); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(byteNewLine); err != nil {
+		return err
+	}
+	if c.Body != nil {
+		var sizeBuf [4]byte
+		binary.BigEndian.PutUint32(sizeBuf[:], uint32(len(c.Body)))
+		if _, err := w.Write(sizeBuf[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(c.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Identify returns a Command that encodes js as the IDENTIFY handshake's
+// body.
+func Identify(js map[string]interface{}) (*Command, error) {
+	body, err := json.Marshal(js)
+	if err != nil {
+		return nil, err
+	}
+	return &Command{Name: []byte("IDENTIFY"), Body: body}, nil
+}
+
+// Auth returns a Command sending secret as an AUTH command's body, in
+// response to nsqd reporting auth_required during IDENTIFY.
+func Auth(secret string) (*Command, error) {
+	return &Command{Name: []byte("AUTH"), Body: []byte(secret)}, nil
+}
+
+// Nop returns a Command that elicits no response from nsqd, sent in reply
+// to a heartbeat to keep the connection alive.
+func Nop() *Command {
+	return &Command{Name: []byte("NOP")}
+}
+
+// Finish returns a Command marking id as successfully processed.
+func Finish(id MessageID) *Command {
+	return &Command{Name: []byte("FIN"), Params: [][]byte{id[:]}}
+}
+
+// Requeue returns a Command putting id back on the queue, to be
+// redelivered after timeoutMs (0 for immediate redelivery).
+func Requeue(id MessageID, timeoutMs int) *Command {
+	return &Command{
+		Name:   []byte("REQ"),
+		Params: [][]byte{id[:], []byte(strconv.Itoa(timeoutMs))},
+	}
+}
+
+// Touch returns a Command resetting id's processing timeout on nsqd,
+// without finishing or requeueing it.
+func Touch(id MessageID) *Command {
+	return &Command{Name: []byte("TOUCH"), Params: [][]byte{id[:]}}
+}
+
+// Subscribe returns a Command subscribing the connection to topic/channel.
+func Subscribe(topic string, channel string) *Command {
+	return &Command{
+		Name:   []byte("SUB"),
+		Params: [][]byte{[]byte(topic), []byte(channel)},
+	}
+}
+
+// Ready returns a Command telling nsqd this connection is willing to
+// accept count messages.
+func Ready(count int) *Command {
+	return &Command{Name: []byte("RDY"), Params: [][]byte{[]byte(strconv.Itoa(count))}}
+}
+
+// StartClose returns a Command beginning the clean-close handshake
+// described in Conn.close's comment.
+func StartClose() *Command {
+	return &Command{Name: []byte("CLS")}
+}
+
+// Publish returns a Command publishing body to topic via PUB.
+func Publish(topic string, body []byte) *Command {
+	return &Command{
+		Name:   []byte("PUB"),
+		Params: [][]byte{[]byte(topic)},
+		Body:   body,
+	}
+}
+
+// MultiPublish returns a Command publishing every entry in bodies to topic
+// in a single MPUB round trip. MPUB's body is a count followed by each
+// body, individually size-prefixed.
+func MultiPublish(topic string, bodies [][]byte) (*Command, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, uint32(len(bodies))); err != nil {
+		return nil, err
+	}
+	for _, b := range bodies {
+		if err := binary.Write(&buf, binary.BigEndian, uint32(len(b))); err != nil {
+			return nil, err
+		}
+		if _, err := buf.Write(b); err != nil {
+			return nil, err
+		}
+	}
+	return &Command{
+		Name:   []byte("MPUB"),
+		Params: [][]byte{[]byte(topic)},
+		Body:   buf.Bytes(),
+	}, nil
+}
+
+// DeferredPublish returns a Command publishing body to topic via DPUB,
+// asking nsqd to delay delivery by delay.
+func DeferredPublish(topic string, delay time.Duration, body []byte) (*Command, error) {
+	return &Command{
+		Name:   []byte("DPUB"),
+		Params: [][]byte{[]byte(topic), []byte(strconv.FormatInt(int64(delay/time.Millisecond), 10))},
+		Body:   body,
+	}, nil
+}
@@ -0,0 +1,237 @@
+package nsq
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds the tunables for a Writer's connection to nsqd. It replaces
+// the dozen individual exported fields Writer used to carry directly, the
+// same way upstream go-nsq's Producer consolidated Writer's fields.
+//
+// A Config is frozen the first time its owning Writer connects (i.e. on the
+// first Publish/PublishAsync/MultiPublish call), after which Set returns an
+// error - nothing should be racing field mutations against router() once a
+// connection is live.
+type Config struct {
+	ReadTimeout  time.Duration // the deadline set for network reads
+	WriteTimeout time.Duration // the deadline set for network writes
+
+	ShortIdentifier string // an identifier to send to nsqd when connecting (defaults: short hostname)
+	LongIdentifier  string // an identifier to send to nsqd when connecting (defaults: long hostname)
+
+	HeartbeatInterval time.Duration // duration of time between heartbeats
+	UserAgent         string        // a string identifying the agent for this client in the spirit of HTTP
+
+	// Transport selects how the Writer's Conn reaches nsqd: TransportTCP
+	// (the default) dials Addr directly; TransportWebSocket tunnels the
+	// protocol over a ws://or wss:// URL given as Addr, for networks that
+	// only allow HTTP out.
+	Transport Transport
+
+	// transport layer security
+	TLSv1     bool        // negotiate enabling TLS
+	TLSConfig *tls.Config // client TLS configuration
+
+	// compression
+	Deflate      bool // negotiate enabling Deflate compression
+	DeflateLevel int  // the compression level to negotiate for Deflate (1-9)
+	Snappy       bool // negotiate enabling Snappy compression
+
+	// output buffering
+	OutputBufferSize    int64         // size of the buffer (in bytes) used by nsqd for buffering writes to this connection
+	OutputBufferTimeout time.Duration // timeout used by nsqd before flushing buffered writes (0 disables)
+
+	// MaxInFlight bounds how many transactions a Writer will queue or have
+	// awaiting a response at once; publish calls beyond this return
+	// ErrPublishQueueFull instead of growing the transaction queue
+	// unbounded. 0 (the default) means unbounded.
+	MaxInFlight int
+
+	frozen int32 // atomic bool, set by freeze() once a Writer using this Config connects
+}
+
+// NewConfig returns a Config populated with the same defaults Writer used
+// to apply to its fields directly.
+func NewConfig() *Config {
+	return &Config{
+		ReadTimeout:  DefaultClientTimeout,
+		WriteTimeout: time.Second,
+
+		DeflateLevel: 6,
+
+		OutputBufferSize:    16 * 1024,
+		OutputBufferTimeout: 250 * time.Millisecond,
+
+		HeartbeatInterval: DefaultClientTimeout / 2,
+
+		UserAgent: fmt.Sprintf("go-nsq/%s", VERSION),
+	}
+}
+
+// frozen reports whether the config has been locked against further Set
+// calls because its Writer has already connected.
+func (c *Config) isFrozen() bool {
+	return atomic.LoadInt32(&c.frozen) == 1
+}
+
+// freeze locks the config against further Set calls. It's idempotent.
+func (c *Config) freeze() {
+	atomic.StoreInt32(&c.frozen, 1)
+}
+
+// Validate checks the Config for internally inconsistent values, returning
+// the first error found. It's called automatically when a Writer connects.
+func (c *Config) Validate() error {
+	if c.DeflateLevel != 0 && (c.DeflateLevel < 1 || c.DeflateLevel > 9) {
+		return fmt.Errorf("DeflateLevel %d must be between 1 and 9", c.DeflateLevel)
+	}
+	if c.HeartbeatInterval != 0 && c.ReadTimeout != 0 && c.HeartbeatInterval >= c.ReadTimeout {
+		return fmt.Errorf("HeartbeatInterval (%s) must be less than ReadTimeout (%s)", c.HeartbeatInterval, c.ReadTimeout)
+	}
+	return nil
+}
+
+// Set assigns value to the named option, converting from the common
+// string/numeric representations a CLI flag parser would hand it. It
+// returns an error if the config has already been frozen by a connected
+// Writer, or if option is unrecognized.
+func (c *Config) Set(option string, value interface{}) error {
+	if c.isFrozen() {
+		return errors.New("nsq.Config: cannot Set after the Writer has connected")
+	}
+
+	switch option {
+	case "read_timeout":
+		v, err := toDuration(value)
+		if err != nil {
+			return err
+		}
+		c.ReadTimeout = v
+	case "write_timeout":
+		v, err := toDuration(value)
+		if err != nil {
+			return err
+		}
+		c.WriteTimeout = v
+	case "heartbeat_interval":
+		v, err := toDuration(value)
+		if err != nil {
+			return err
+		}
+		c.HeartbeatInterval = v
+	case "short_identifier":
+		c.ShortIdentifier = fmt.Sprintf("%v", value)
+	case "long_identifier":
+		c.LongIdentifier = fmt.Sprintf("%v", value)
+	case "user_agent":
+		c.UserAgent = fmt.Sprintf("%v", value)
+	case "transport":
+		v, err := toTransport(value)
+		if err != nil {
+			return err
+		}
+		c.Transport = v
+	case "tls_v1":
+		v, err := toBool(value)
+		if err != nil {
+			return err
+		}
+		c.TLSv1 = v
+	case "deflate":
+		v, err := toBool(value)
+		if err != nil {
+			return err
+		}
+		c.Deflate = v
+	case "deflate_level":
+		v, err := toInt(value)
+		if err != nil {
+			return err
+		}
+		c.DeflateLevel = v
+	case "snappy":
+		v, err := toBool(value)
+		if err != nil {
+			return err
+		}
+		c.Snappy = v
+	case "output_buffer_size":
+		v, err := toInt(value)
+		if err != nil {
+			return err
+		}
+		c.OutputBufferSize = int64(v)
+	case "output_buffer_timeout":
+		v, err := toDuration(value)
+		if err != nil {
+			return err
+		}
+		c.OutputBufferTimeout = v
+	case "max_in_flight":
+		v, err := toInt(value)
+		if err != nil {
+			return err
+		}
+		c.MaxInFlight = v
+	default:
+		return fmt.Errorf("nsq.Config: unknown option %q", option)
+	}
+
+	return c.Validate()
+}
+
+func toBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return false, fmt.Errorf("unable to convert %+v to bool", value)
+}
+
+func toInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	}
+	return 0, fmt.Errorf("unable to convert %+v to int", value)
+}
+
+func toTransport(value interface{}) (Transport, error) {
+	switch v := value.(type) {
+	case Transport:
+		return v, nil
+	case string:
+		switch v {
+		case "tcp", "":
+			return TransportTCP, nil
+		case "websocket":
+			return TransportWebSocket, nil
+		}
+	}
+	return TransportTCP, fmt.Errorf("unable to convert %+v to Transport", value)
+}
+
+func toDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(v)
+	case int:
+		return time.Duration(v) * time.Millisecond, nil
+	case int64:
+		return time.Duration(v) * time.Millisecond, nil
+	}
+	return 0, fmt.Errorf("unable to convert %+v to time.Duration", value)
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"compress/flate"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -23,10 +24,19 @@ import (
 // IdentifyResponse represents the metadata
 // returned from an IDENTIFY command to nsqd
 type IdentifyResponse struct {
-	MaxRdyCount int64 `json:"max_rdy_count"`
-	TLSv1       bool  `json:"tls_v1"`
-	Deflate     bool  `json:"deflate"`
-	Snappy      bool  `json:"snappy"`
+	MaxRdyCount  int64 `json:"max_rdy_count"`
+	TLSv1        bool  `json:"tls_v1"`
+	Deflate      bool  `json:"deflate"`
+	Snappy       bool  `json:"snappy"`
+	AuthRequired bool  `json:"auth_required"`
+}
+
+// AuthResponse represents the metadata returned from an AUTH command,
+// sent after IDENTIFY when nsqd reports auth_required
+type AuthResponse struct {
+	Identity        string `json:"identity"`
+	IdentityURL     string `json:"identity_url"`
+	PermissionCount int64  `json:"permission_count"`
 }
 
 // Conn represents a connection to nsqd
@@ -53,6 +63,26 @@ type Conn struct {
 	r io.Reader
 	w io.Writer
 
+	// Dialer establishes the underlying net.Conn to addr. Defaults to a
+	// plain TCP dial; set to a *webSocketDialer (via Writer's
+	// Config.Transport) to tunnel the protocol over WebSocket instead.
+	Dialer Dialer
+
+	// Codec negotiates the wire version and frames reads. Defaults to
+	// protocolV2Codec; set before Connect to speak an alternative framing.
+	Codec Codec
+
+	logger    Logger
+	logLvl    LogLevel
+	logPrefix string
+
+	// ctx is cancelled as soon as the connection starts closing, so
+	// per-message contexts handed out via Message.Context() (and any other
+	// work derived from this Conn's lifetime) can be torn down promptly
+	// instead of running unboundedly past Stop().
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	// ResponseCB is called when the connection
 	// receives a FrameTypeResponse from nsqd
 	ResponseCB func(*Conn, []byte)
@@ -81,6 +111,15 @@ type Conn struct {
 	// closes, after all cleanup
 	CloseCB func(*Conn)
 
+	// AuthCB is called after a successful AUTH command, in response to
+	// nsqd reporting auth_required during IDENTIFY
+	AuthCB func(*Conn, *AuthResponse)
+
+	// AuthSecret is sent via an AUTH command immediately after IDENTIFY if
+	// nsqd reports auth_required. Leave empty to skip AUTH even if nsqd
+	// requires it, in which case identify() returns an error.
+	AuthSecret string
+
 	cmdBuf bytes.Buffer
 
 	flateWriter *flate.Writer
@@ -129,12 +168,22 @@ func NewConn(addr string, topic string, channel string) *Conn {
 	if err != nil {
 		log.Fatalf("ERROR: unable to get hostname %s", err.Error())
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Conn{
 		addr: addr,
 
 		topic:   topic,
 		channel: channel,
 
+		ctx:    ctx,
+		cancel: cancel,
+
+		Codec: protocolV2Codec{},
+
+		logger:    log.New(os.Stderr, "", log.LstdFlags),
+		logLvl:    LogLevelDebug,
+		logPrefix: fmt.Sprintf("(%s)", addr),
+
 		ReadTimeout:  DefaultClientTimeout,
 		WriteTimeout: time.Second,
 
@@ -162,7 +211,20 @@ func NewConn(addr string, topic string, channel string) *Conn {
 // Connect dials and bootstraps the nsqd connection
 // (including IDENTIFY) and returns the IdentifyResponse
 func (c *Conn) Connect() (*IdentifyResponse, error) {
-	conn, err := net.DialTimeout("tcp", c.addr, time.Second)
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext is Connect, but derives the Conn's lifetime ctx (later
+// exposed to message handlers via Message.Context) from ctx, and abandons
+// the dial and IDENTIFY handshake with ctx.Err() if ctx is done first.
+func (c *Conn) ConnectContext(ctx context.Context) (*IdentifyResponse, error) {
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = &tcpDialer{addr: c.addr, timeout: time.Second}
+	}
+	conn, err := dialer.Dial(c.ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -170,10 +232,13 @@ func (c *Conn) Connect() (*IdentifyResponse, error) {
 	c.r = conn
 	c.w = conn
 
-	_, err = c.Write(MagicV2)
-	if err != nil {
+	codec := c.Codec
+	if codec == nil {
+		codec = protocolV2Codec{}
+	}
+	if err := codec.Negotiate(c); err != nil {
 		c.Close()
-		return nil, fmt.Errorf("[%s] failed to write magic - %s", c.addr, err)
+		return nil, fmt.Errorf("[%s] failed to negotiate protocol - %s", c.addr, err)
 	}
 
 	resp, err := c.identify()
@@ -250,6 +315,32 @@ func (c *Conn) String() string {
 	return fmt.Sprintf("%s/%s/%s", c.addr, c.topic, c.channel)
 }
 
+// SetLogger assigns the logger to use, along with a level above which
+// messages are filtered out, and a string prefix that's prepended to every
+// line (the connection's address/topic/channel is always included too).
+// Use NopLogger() to silence the Conn entirely.
+func (c *Conn) SetLogger(logger Logger, lvl LogLevel, prefix string) {
+	c.logger = logger
+	c.logLvl = lvl
+	c.logPrefix = prefix
+}
+
+// logf emits a structured log line, always tagging it with this
+// connection's addr/topic/channel so operators can filter/aggregate
+// without scraping a formatted prefix.
+func (c *Conn) logf(lvl LogLevel, msg string, fields ...field) {
+	if c.logger == nil || lvl < c.logLvl {
+		return
+	}
+	all := append([]field{
+		logField("prefix", c.logPrefix),
+		logField("addr", c.addr),
+		logField("topic", c.topic),
+		logField("channel", c.channel),
+	}, fields...)
+	c.logger.Output(2, renderLogLine(lvl, msg, all...))
+}
+
 // Read performs a deadlined read on the underlying TCP connection
 func (c *Conn) Read(p []byte) (int, error) {
 	c.SetReadDeadline(time.Now().Add(c.ReadTimeout))
@@ -286,15 +377,28 @@ func (c *Conn) SendCommand(cmd *Command) error {
 	return nil
 }
 
+// SendCommandContext is SendCommand, but abandons the write with ctx.Err()
+// if ctx is done before the write completes.
+func (c *Conn) SendCommandContext(ctx context.Context, cmd *Command) error {
+	done := make(chan error, 1)
+	go func() { done <- c.SendCommand(cmd) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // ReadUnpackedResponse reads and parses data from the underlying
 // TCP connection according to the NSQ TCP protocol spec and
 // returns the frameType, data or error
 func (c *Conn) ReadUnpackedResponse() (int32, []byte, error) {
-	resp, err := ReadResponse(c)
-	if err != nil {
-		return -1, nil, err
+	codec := c.Codec
+	if codec == nil {
+		codec = protocolV2Codec{}
 	}
-	return UnpackResponse(resp)
+	return codec.ReadFrame(c)
 }
 
 func (c *Conn) identify() (*IdentifyResponse, error) {
@@ -368,9 +472,52 @@ func (c *Conn) identify() (*IdentifyResponse, error) {
 	// now that connection is bootstrapped, enable read buffering
 	c.r = bufio.NewReader(c.r)
 
+	if resp.AuthRequired {
+		if c.AuthSecret == "" {
+			return nil, ErrIdentify{"auth required but AuthSecret not set"}
+		}
+		if err := c.auth(c.AuthSecret); err != nil {
+			return nil, ErrIdentify{err.Error()}
+		}
+	}
+
 	return resp, nil
 }
 
+// auth sends an AUTH command with secret and parses the AuthResponse,
+// invoking AuthCB (if set) on success
+func (c *Conn) auth(secret string) error {
+	cmd, err := Auth(secret)
+	if err != nil {
+		return err
+	}
+
+	err = c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	frameType, data, err := c.ReadUnpackedResponse()
+	if err != nil {
+		return err
+	}
+
+	if frameType == FrameTypeError {
+		return errors.New(string(data))
+	}
+
+	resp := &AuthResponse{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+
+	if c.AuthCB != nil {
+		c.AuthCB(c, resp)
+	}
+
+	return nil
+}
+
 func (c *Conn) upgradeTLS(conf *tls.Config) error {
 	c.tlsConn = tls.Client(c.Conn, conf)
 	err := c.tlsConn.Handshake()
@@ -458,16 +605,19 @@ func (c *Conn) readLoop() {
 			}
 			msg.cmdChan = c.cmdChan
 			msg.responseChan = c.finishedMessages
-			msg.exitChan = c.exitChan
+			msg.ctx = c.ctx
 
 			atomic.AddInt64(&c.rdyCount, -1)
 			atomic.AddInt64(&c.messagesInFlight, 1)
 			atomic.StoreInt64(&c.lastMsgTimestamp, time.Now().UnixNano())
 
+			c.logf(LogLevelDebug, "received message",
+				logField("msg_id", string(msg.Id[:])), logField("frame_type", frameType))
 			c.MessageCB(c, msg)
 		case FrameTypeError:
 			c.ErrorCB(c, data)
 		default:
+			c.logf(LogLevelError, "unknown frame type", logField("frame_type", frameType))
 			c.IOErrorCB(c, fmt.Errorf("unknown frame type %d", frameType))
 		}
 	}
@@ -482,25 +632,24 @@ exit:
 		// writeLoop won't
 		c.close()
 	} else {
-		log.Printf("[%s] delaying close, %d outstanding messages",
-			c, messagesInFlight)
+		c.logf(LogLevelInfo, "delaying close, outstanding messages", logField("messages_in_flight", messagesInFlight))
 	}
 	c.wg.Done()
-	log.Printf("[%s] readLoop exiting", c)
+	c.logf(LogLevelInfo, "readLoop exiting")
 }
 
 func (c *Conn) writeLoop() {
 	for {
 		select {
 		case <-c.exitChan:
-			log.Printf("[%s] breaking out of writeLoop", c)
+			c.logf(LogLevelInfo, "breaking out of writeLoop")
 			// Indicate drainReady because we will not pull any more off finishedMessages
 			close(c.drainReady)
 			goto exit
 		case cmd := <-c.cmdChan:
 			err := c.SendCommand(cmd)
 			if err != nil {
-				log.Printf("[%s] error sending command %s - %s", c, cmd, err)
+				c.logf(LogLevelError, "error sending command", logField("cmd", cmd), logField("error", err))
 				c.close()
 				continue
 			}
@@ -511,14 +660,14 @@ func (c *Conn) writeLoop() {
 			if finishedMsg.Success {
 				err := c.SendCommand(Finish(finishedMsg.Id))
 				if err != nil {
-					log.Printf("[%s] error finishing %s - %s", c, finishedMsg.Id, err.Error())
+					c.logf(LogLevelError, "error finishing message", logField("msg_id", string(finishedMsg.Id[:])), logField("error", err.Error()))
 					c.close()
 					continue
 				}
 			} else {
 				err := c.SendCommand(Requeue(finishedMsg.Id, finishedMsg.RequeueDelayMs))
 				if err != nil {
-					log.Printf("[%s] error requeueing %s - %s", c, finishedMsg.Id, err.Error())
+					c.logf(LogLevelError, "error requeueing message", logField("msg_id", string(finishedMsg.Id[:])), logField("error", err.Error()))
 					c.close()
 					continue
 				}
@@ -535,7 +684,7 @@ func (c *Conn) writeLoop() {
 
 exit:
 	c.wg.Done()
-	log.Printf("[%s] writeLoop exiting", c)
+	c.logf(LogLevelInfo, "writeLoop exiting")
 }
 
 func (c *Conn) close() {
@@ -565,7 +714,8 @@ func (c *Conn) close() {
 	//         d. trigger CloseCB()
 	//
 	c.stopper.Do(func() {
-		log.Printf("[%s] beginning close", c)
+		c.logf(LogLevelInfo, "beginning close")
+		c.cancel()
 		close(c.exitChan)
 
 		c.wg.Add(1)
@@ -595,13 +745,13 @@ func (c *Conn) cleanup() {
 			msgsInFlight = atomic.LoadInt64(&c.messagesInFlight)
 		}
 		if msgsInFlight > 0 {
-			log.Printf("[%s] draining... waiting for %d messages in flight", c, msgsInFlight)
+			c.logf(LogLevelInfo, "draining... waiting for messages in flight", logField("messages_in_flight", msgsInFlight))
 			continue
 		}
 		// until the readLoop has exited we cannot be sure that there
 		// still won't be a race
 		if atomic.LoadInt32(&c.readLoopRunning) == 1 {
-			log.Printf("[%s] draining... readLoop still running", c)
+			c.logf(LogLevelInfo, "draining... readLoop still running")
 			continue
 		}
 		goto exit
@@ -610,7 +760,7 @@ func (c *Conn) cleanup() {
 exit:
 	ticker.Stop()
 	c.wg.Done()
-	log.Printf("[%s] finished draining, cleanup exiting", c)
+	c.logf(LogLevelInfo, "finished draining, cleanup exiting")
 }
 
 func (c *Conn) waitForCleanup() {
@@ -619,6 +769,6 @@ func (c *Conn) waitForCleanup() {
 	c.wg.Wait()
 	// actually close the underlying connection
 	c.Close()
-	log.Printf("[%s] clean close complete", c)
+	c.logf(LogLevelInfo, "clean close complete")
 	c.CloseCB(c)
 }
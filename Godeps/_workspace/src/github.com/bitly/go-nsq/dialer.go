@@ -0,0 +1,41 @@
+package nsq
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Transport selects how a Conn reaches nsqd.
+type Transport int
+
+const (
+	// TransportTCP dials nsqd's TCP protocol port directly. This is the
+	// default and what every nsqd speaks out of the box.
+	TransportTCP Transport = iota
+	// TransportWebSocket tunnels the same binary NSQ protocol inside a
+	// WebSocket connection, for clients that sit behind an HTTP-only
+	// proxy/load balancer (or in a browser) and can't open a raw TCP
+	// connection to nsqd. It requires a companion proxy in front of nsqd
+	// that terminates the WebSocket and forwards the frames' payloads to
+	// nsqd's TCP port - nsqd itself does not speak WebSocket.
+	TransportWebSocket
+)
+
+// Dialer establishes the underlying net.Conn a Conn speaks the NSQ
+// protocol over. TCP is the default implementation; WebSocket is provided
+// for traversing HTTP-only networks.
+type Dialer interface {
+	Dial(ctx context.Context) (net.Conn, error)
+}
+
+// tcpDialer is the default Dialer, dialing addr directly over TCP.
+type tcpDialer struct {
+	addr    string
+	timeout time.Duration
+}
+
+func (d *tcpDialer) Dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: d.timeout}
+	return dialer.DialContext(ctx, "tcp", d.addr)
+}
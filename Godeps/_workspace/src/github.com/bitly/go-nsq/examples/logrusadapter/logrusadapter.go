@@ -0,0 +1,34 @@
+// Package logrusadapter demonstrates how to bridge nsq.Logger to a
+// third-party structured logging framework. It is not imported by package
+// nsq itself - a Writer/Conn consumer that wants this must opt in.
+//
+// A zap-backed adapter looks the same shape: wrap *zap.SugaredLogger and
+// call Infow from Output instead of Entry.Info.
+package logrusadapter
+
+import (
+	"github.com/bitly/go-nsq"
+	"github.com/sirupsen/logrus"
+)
+
+// LogrusAdapter adapts a *logrus.Logger (or any *logrus.Entry-compatible
+// FieldLogger) to the nsq.Logger interface, so a Writer/Conn already
+// emitting structured "key=value" lines can instead hand them to an
+// application's existing logrus pipeline.
+type LogrusAdapter struct {
+	Entry *logrus.Entry
+}
+
+// NewLogrusAdapter returns an nsq.Logger that forwards every line to logger.
+func NewLogrusAdapter(logger *logrus.Logger) *LogrusAdapter {
+	return &LogrusAdapter{Entry: logrus.NewEntry(logger)}
+}
+
+// Output implements nsq.Logger. calldepth is ignored - logrus reports its
+// own call site rather than the stdlib log package's.
+func (a *LogrusAdapter) Output(calldepth int, s string) error {
+	a.Entry.Info(s)
+	return nil
+}
+
+var _ nsq.Logger = (*LogrusAdapter)(nil)
@@ -0,0 +1,81 @@
+package nsq
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// LogLevel specifies the severity of a given log message, used to gate
+// what a Writer or Conn actually writes to its configured Logger.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarning
+	LogLevelError
+)
+
+// String returns the fixed-width level tag used to prefix log lines.
+func (lvl LogLevel) String() string {
+	switch lvl {
+	case LogLevelInfo:
+		return "INF"
+	case LogLevelWarning:
+		return "WRN"
+	case LogLevelError:
+		return "ERR"
+	default:
+		return "DBG"
+	}
+}
+
+// Logger is the logging interface used by Writer and Conn. The standard
+// library's *log.Logger satisfies it, so callers can pass one straight
+// through to SetLogger.
+type Logger interface {
+	Output(calldepth int, s string) error
+}
+
+type nopLogger struct{}
+
+func (*nopLogger) Output(calldepth int, s string) error { return nil }
+
+// NopLogger returns a Logger that discards everything written to it.
+func NopLogger() Logger {
+	return &nopLogger{}
+}
+
+// StdLogger returns a Logger backed by the standard library's log package,
+// writing to stderr with prefix - the same default Writer and Conn start
+// with before SetLogger is called.
+func StdLogger(prefix string) Logger {
+	return log.New(os.Stderr, prefix, log.LstdFlags)
+}
+
+// field is one structured key/value pair attached to a log line. Use it to
+// give operators machine-parseable fields (addr, topic, channel, msg_id,
+// frame_type, ...) instead of scraping prefixes out of a formatted string,
+// the way EventRouter's LogFilter had to.
+type field struct {
+	key   string
+	value interface{}
+}
+
+func logField(key string, value interface{}) field {
+	return field{key: key, value: value}
+}
+
+// renderLogLine formats lvl, msg, and fields as a single logfmt-style line
+// that's still just a string, so any Logger (including a plain *log.Logger)
+// can consume it without knowing about structured fields at all.
+func renderLogLine(lvl LogLevel, msg string, fields ...field) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-4s msg=%q", lvl, msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.key, f.value)
+	}
+	return b.String()
+}
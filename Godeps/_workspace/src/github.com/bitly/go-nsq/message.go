@@ -2,6 +2,7 @@ package nsq
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"io"
 	"io/ioutil"
@@ -21,7 +22,7 @@ type Message struct {
 	Timestamp int64
 	Attempts  uint16
 
-	exitChan     chan int
+	ctx          context.Context
 	cmdChan      chan *Command
 	responseChan chan *FinishedMessage
 }
@@ -36,15 +37,42 @@ func NewMessage(id MessageID, body []byte) *Message {
 	}
 }
 
+// Context returns the context tied to the Conn that delivered this message,
+// cancelled as soon as that connection starts closing. Handlers that spawn
+// subprocesses or other cancellable work (e.g. via exec.CommandContext)
+// should derive from it instead of running unboundedly past Stop(). Messages
+// built directly with NewMessage carry no connection, so Context returns
+// context.Background().
+func (m *Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// FinishedMessage is sent on a Message's responseChan to tell the owning
+// Conn's writeLoop whether to FIN or REQ the message.
+type FinishedMessage struct {
+	Id             MessageID
+	RequeueDelayMs int
+	Success        bool
+}
+
 // Touch sends a TOUCH command to the nsqd which
 // sent this message
 func (m *Message) Touch() {
 	select {
 	case m.cmdChan <- Touch(m.Id):
-	case <-m.exitChan:
+	case <-m.Context().Done():
 	}
 }
 
+// Finish sends a FIN command to the nsqd which sent this message,
+// indicating successful processing.
+func (m *Message) Finish() {
+	m.responseChan <- &FinishedMessage{Id: m.Id, Success: true}
+}
+
 // Requeue sends a REQUEUE command to the nsqd which
 // sent this message, using the supplied delay
 func (m *Message) Requeue(timeoutMs int) {
@@ -0,0 +1,218 @@
+package nsq
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Producer is a minimal, single-connection publisher. Unlike Writer (which
+// queues transactions behind a router() goroutine so many callers can
+// publish concurrently without blocking on each other), Producer serializes
+// publishes behind a mutex and blocks the calling goroutine for the
+// duration of a single PUB/MPUB/DPUB round trip. It exists for callers like
+// EventRouter that just need to emit a response event back to nsqd without
+// pulling in Writer's queuing machinery.
+//
+// Producer reuses Conn's identify()/upgradeTLS/upgradeDeflate/upgradeSnappy
+// negotiation unchanged - it only wires up the publish-relevant callbacks.
+type Producer struct {
+	Addr string
+	cfg  *Config
+
+	logger    Logger
+	logLvl    LogLevel
+	logPrefix string
+
+	mtx          sync.Mutex
+	conn         *Conn
+	responseChan chan []byte
+	errorChan    chan []byte
+	ioErrorChan  chan error
+}
+
+// ProducerResponse is delivered on the channel passed to PublishAsync once
+// nsqd responds (or the connection fails) for that publish.
+type ProducerResponse struct {
+	FrameType int32
+	Data      []byte
+	Error     error
+}
+
+// NewProducer returns a Producer for the specified nsqd address, configured
+// by cfg (which defaults via NewConfig if nil). The connection is lazily
+// established on the first Publish/MultiPublish/DeferredPublish call.
+func NewProducer(addr string, cfg *Config) *Producer {
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+	return &Producer{
+		Addr: addr,
+		cfg:  cfg,
+
+		logger:    log.New(os.Stderr, "", log.LstdFlags),
+		logLvl:    LogLevelDebug,
+		logPrefix: fmt.Sprintf("(%s)", addr),
+
+		responseChan: make(chan []byte),
+		errorChan:    make(chan []byte),
+		ioErrorChan:  make(chan error),
+	}
+}
+
+// String returns the address of the Producer
+func (p *Producer) String() string {
+	return p.Addr
+}
+
+// SetLogger assigns the logger to use, along with a level above which
+// messages are filtered out, and a string prefix that's prepended to every
+// line (the connection's address is always included too). Use NopLogger()
+// to silence the Producer entirely.
+func (p *Producer) SetLogger(logger Logger, lvl LogLevel, prefix string) {
+	p.logger = logger
+	p.logLvl = lvl
+	p.logPrefix = prefix
+}
+
+// Publish synchronously publishes a message body to the specified topic,
+// returning the response frameType, data, and error
+func (p *Producer) Publish(topic string, body []byte) (int32, []byte, error) {
+	return p.sendCommand(Publish(topic, body))
+}
+
+// MultiPublish synchronously publishes a slice of message bodies to the
+// specified topic in a single MPUB command, returning the response
+// frameType, data, and error
+func (p *Producer) MultiPublish(topic string, bodies [][]byte) (int32, []byte, error) {
+	cmd, err := MultiPublish(topic, bodies)
+	if err != nil {
+		return -1, nil, err
+	}
+	return p.sendCommand(cmd)
+}
+
+// DeferredPublish synchronously publishes body to topic via DPUB, asking
+// nsqd to delay delivery by delay, returning the response frameType, data,
+// and error
+func (p *Producer) DeferredPublish(topic string, delay time.Duration, body []byte) (int32, []byte, error) {
+	cmd, err := DeferredPublish(topic, delay, body)
+	if err != nil {
+		return -1, nil, err
+	}
+	return p.sendCommand(cmd)
+}
+
+// PublishAsync publishes a message body to the specified topic without
+// waiting for nsqd's response; respChan (if non-nil) receives a
+// ProducerResponse once the round trip completes.
+func (p *Producer) PublishAsync(topic string, body []byte, respChan chan *ProducerResponse) {
+	go func() {
+		frameType, data, err := p.Publish(topic, body)
+		if respChan != nil {
+			respChan <- &ProducerResponse{FrameType: frameType, Data: data, Error: err}
+		}
+	}()
+}
+
+// Stop closes the underlying connection, if any. A stopped Producer
+// reconnects lazily on the next publish call.
+func (p *Producer) Stop() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.teardown()
+}
+
+func (p *Producer) sendCommand(cmd *Command) (int32, []byte, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return -1, nil, err
+		}
+	}
+
+	if err := p.conn.SendCommand(cmd); err != nil {
+		p.teardown()
+		return -1, nil, err
+	}
+
+	select {
+	case data := <-p.responseChan:
+		return FrameTypeResponse, data, nil
+	case data := <-p.errorChan:
+		return FrameTypeError, data, nil
+	case err := <-p.ioErrorChan:
+		p.teardown()
+		return -1, nil, err
+	}
+}
+
+func (p *Producer) connect() error {
+	if err := p.cfg.Validate(); err != nil {
+		return err
+	}
+	p.cfg.freeze()
+
+	conn := NewConn(p.Addr, "", "")
+	conn.SetLogger(p.logger, p.logLvl, p.logPrefix)
+	if p.cfg.Transport == TransportWebSocket {
+		conn.Dialer = &webSocketDialer{addr: p.Addr, tlsConfig: p.cfg.TLSConfig}
+	}
+	if p.cfg.ReadTimeout > 0 {
+		conn.ReadTimeout = p.cfg.ReadTimeout
+	}
+	if p.cfg.WriteTimeout > 0 {
+		conn.WriteTimeout = p.cfg.WriteTimeout
+	}
+	conn.Deflate = p.cfg.Deflate
+	if p.cfg.DeflateLevel > 0 {
+		conn.DeflateLevel = p.cfg.DeflateLevel
+	}
+	conn.Snappy = p.cfg.Snappy
+	conn.TLSv1 = p.cfg.TLSv1
+	conn.TLSConfig = p.cfg.TLSConfig
+	if p.cfg.ShortIdentifier != "" {
+		conn.ShortIdentifier = p.cfg.ShortIdentifier
+	}
+	if p.cfg.LongIdentifier != "" {
+		conn.LongIdentifier = p.cfg.LongIdentifier
+	}
+	if p.cfg.HeartbeatInterval != 0 {
+		conn.HeartbeatInterval = p.cfg.HeartbeatInterval
+	}
+	if p.cfg.OutputBufferSize != 0 {
+		conn.OutputBufferSize = p.cfg.OutputBufferSize
+	}
+	if p.cfg.OutputBufferTimeout != 0 {
+		conn.OutputBufferTimeout = p.cfg.OutputBufferTimeout
+	}
+	if p.cfg.UserAgent != "" {
+		conn.UserAgent = p.cfg.UserAgent
+	}
+
+	conn.ResponseCB = func(c *Conn, data []byte) { p.responseChan <- data }
+	conn.ErrorCB = func(c *Conn, data []byte) { p.errorChan <- data }
+	conn.HeartbeatCB = func(c *Conn) {}
+	conn.IOErrorCB = func(c *Conn, err error) { p.ioErrorChan <- err }
+	conn.CloseCB = func(c *Conn) {}
+
+	_, err := conn.Connect()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.conn = conn
+	return nil
+}
+
+func (p *Producer) teardown() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn = nil
+}
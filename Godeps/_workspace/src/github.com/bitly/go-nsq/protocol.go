@@ -0,0 +1,64 @@
+package nsq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// VERSION is the version of this go-nsq client, reported to nsqd as part of
+// the default UserAgent.
+const VERSION = "1.0.0-compat"
+
+// DefaultClientTimeout is the read deadline a Conn uses absent an explicit
+// ReadTimeout, and the basis for its default HeartbeatInterval.
+const DefaultClientTimeout = 60 * time.Second
+
+// MagicV2 is written immediately after dialing nsqd, before IDENTIFY, to
+// select the V2 wire protocol.
+var MagicV2 = []byte("  V2")
+
+// Frame types, as reported by UnpackResponse.
+const (
+	FrameTypeResponse int32 = 0
+	FrameTypeError    int32 = 1
+	FrameTypeMessage  int32 = 2
+)
+
+// ReadResponse reads a single size-prefixed frame off r: a 4-byte
+// big-endian length followed by that many bytes of frame data.
+func ReadResponse(r io.Reader) ([]byte, error) {
+	var msgSize int32
+	if err := binary.Read(r, binary.BigEndian, &msgSize); err != nil {
+		return nil, err
+	}
+	if msgSize <= 0 {
+		return nil, fmt.Errorf("response size %d is not valid", msgSize)
+	}
+	buf := make([]byte, msgSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// UnpackResponse splits a frame (as returned by ReadResponse) into its
+// frame type and payload: the first 4 bytes are a big-endian frame type,
+// and the rest is the frame's data.
+func UnpackResponse(response []byte) (int32, []byte, error) {
+	if len(response) < 4 {
+		return -1, nil, fmt.Errorf("length of response is too small (%d)", len(response))
+	}
+	return int32(binary.BigEndian.Uint32(response)), response[4:], nil
+}
+
+// ErrIdentify is returned by Conn's IDENTIFY handshake (including any
+// TLS/Deflate/Snappy/AUTH negotiation it triggers) on failure.
+type ErrIdentify struct {
+	Reason string
+}
+
+func (e ErrIdentify) Error() string {
+	return fmt.Sprintf("failed to IDENTIFY - %s", e.Reason)
+}
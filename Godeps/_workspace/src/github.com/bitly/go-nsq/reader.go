@@ -0,0 +1,338 @@
+package nsq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLookupdPollInterval is how often a Reader re-queries its
+// configured nsqlookupd addresses for the topic's current producers.
+const DefaultLookupdPollInterval = 60 * time.Second
+
+// Handler is implemented by types that process messages delivered by a
+// Reader. Returning nil FINishes the message; returning an error REQueues
+// it after backoffMs (currently always 0 - immediate redelivery).
+type Handler interface {
+	HandleMessage(message *Message) error
+}
+
+// Reader is a high-level type that subscribes to a topic/channel across one
+// or more nsqd connections (dialed directly via ConnectToNSQ, or discovered
+// via ConnectToLookupd) and dispatches each delivered Message to its
+// Handlers.
+type Reader struct {
+	TopicName   string
+	ChannelName string
+
+	// ExitChan is closed once Stop has torn down every connection.
+	ExitChan chan int
+
+	maxInFlight int64
+
+	logger Logger
+	logLvl LogLevel
+
+	mtx   sync.RWMutex
+	conns map[string]*Conn
+
+	handlers   []Handler
+	handlerIdx uint64
+
+	lookupdHTTPAddrs []string
+	lookupdStarted   int32
+	lookupdTicker    *time.Ticker
+
+	stopFlag int32
+	stopChan chan int
+	wg       sync.WaitGroup
+}
+
+// NewReader validates topic/channel and returns a Reader ready to
+// AddHandler/ConnectToNSQ/ConnectToLookupd.
+func NewReader(topic string, channel string) (*Reader, error) {
+	if topic == "" {
+		return nil, errors.New("nsq: topic is required")
+	}
+	if channel == "" {
+		return nil, errors.New("nsq: channel is required")
+	}
+	return &Reader{
+		TopicName:   topic,
+		ChannelName: channel,
+
+		ExitChan: make(chan int),
+		stopChan: make(chan int),
+
+		maxInFlight: 1,
+
+		logger: log.New(os.Stderr, "", log.LstdFlags),
+		logLvl: LogLevelDebug,
+
+		conns: make(map[string]*Conn),
+	}, nil
+}
+
+// SetLogger assigns the logger used by the Reader and every Conn it dials,
+// along with a level above which messages are filtered out. Use
+// NopLogger() to silence it entirely.
+func (r *Reader) SetLogger(logger Logger, lvl LogLevel) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.logger = logger
+	r.logLvl = lvl
+}
+
+func (r *Reader) log(lvl LogLevel, line string, args ...interface{}) {
+	if r.logger == nil || lvl < r.logLvl {
+		return
+	}
+	r.logger.Output(2, fmt.Sprintf("%-4s [%s/%s] %s", lvl, r.TopicName, r.ChannelName, fmt.Sprintf(line, args...)))
+}
+
+// AddHandler registers h to receive a share of delivered messages,
+// round-robining across every handler added so far.
+func (r *Reader) AddHandler(h Handler) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.handlers = append(r.handlers, h)
+}
+
+// SetMaxInFlight bounds how many messages, summed across every connection,
+// this Reader asks nsqd to have outstanding at once. It takes effect
+// immediately on already-connected conns as well as ones connected later.
+func (r *Reader) SetMaxInFlight(max int) {
+	atomic.StoreInt64(&r.maxInFlight, int64(max))
+	r.redistributeRDY()
+}
+
+// redistributeRDY spreads maxInFlight evenly (rounding down, with any
+// remainder on the first conns) across every currently connected conn.
+func (r *Reader) redistributeRDY() {
+	r.mtx.RLock()
+	conns := make([]*Conn, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mtx.RUnlock()
+
+	if len(conns) == 0 {
+		return
+	}
+
+	max := atomic.LoadInt64(&r.maxInFlight)
+	per := max / int64(len(conns))
+	remainder := max % int64(len(conns))
+	for i, c := range conns {
+		rdy := per
+		if int64(i) < remainder {
+			rdy++
+		}
+		if err := c.SendCommand(Ready(int(rdy))); err != nil {
+			r.log(LogLevelError, "failed to update RDY on %s - %s", c.String(), err)
+			continue
+		}
+		c.SetRDY(rdy)
+	}
+}
+
+// ConnectToNSQ dials addr directly, subscribes to the Reader's
+// topic/channel, and folds the connection into this Reader's RDY
+// distribution. It's idempotent for an addr that's already connected.
+func (r *Reader) ConnectToNSQ(addr string) error {
+	if atomic.LoadInt32(&r.stopFlag) == 1 {
+		return errors.New("nsq: reader is stopped")
+	}
+
+	r.mtx.Lock()
+	if _, ok := r.conns[addr]; ok {
+		r.mtx.Unlock()
+		return nil
+	}
+	r.mtx.Unlock()
+
+	conn := NewConn(addr, r.TopicName, r.ChannelName)
+	conn.SetLogger(r.logger, r.logLvl, fmt.Sprintf("(%s)", addr))
+
+	conn.MessageCB = r.handleMessage
+	conn.ResponseCB = func(c *Conn, data []byte) {}
+	conn.ErrorCB = func(c *Conn, data []byte) {
+		r.log(LogLevelError, "%s error response - %s", c.String(), data)
+	}
+	conn.HeartbeatCB = func(c *Conn) {}
+	conn.IOErrorCB = func(c *Conn, err error) {
+		r.log(LogLevelError, "%s IO error - %s", c.String(), err)
+		r.removeConn(addr)
+	}
+	conn.CloseCB = func(c *Conn) {
+		r.removeConn(addr)
+	}
+
+	if _, err := conn.Connect(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := conn.SendCommand(Subscribe(r.TopicName, r.ChannelName)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	r.mtx.Lock()
+	r.conns[addr] = conn
+	r.mtx.Unlock()
+
+	r.redistributeRDY()
+	return nil
+}
+
+func (r *Reader) removeConn(addr string) {
+	r.mtx.Lock()
+	_, ok := r.conns[addr]
+	delete(r.conns, addr)
+	r.mtx.Unlock()
+	if ok {
+		r.redistributeRDY()
+	}
+}
+
+// handleMessage dispatches msg to one of the Reader's handlers
+// (round-robin), FINishing it on success or REQueueing it (for immediate
+// redelivery) if the handler returns an error.
+func (r *Reader) handleMessage(c *Conn, msg *Message) {
+	r.mtx.RLock()
+	handlers := r.handlers
+	r.mtx.RUnlock()
+
+	if len(handlers) == 0 {
+		r.log(LogLevelWarning, "message %s received with no handlers registered", string(msg.Id[:]))
+		msg.Requeue(0)
+		return
+	}
+
+	idx := atomic.AddUint64(&r.handlerIdx, 1)
+	h := handlers[idx%uint64(len(handlers))]
+
+	if err := h.HandleMessage(msg); err != nil {
+		r.log(LogLevelError, "handler returned error for %s - %s", string(msg.Id[:]), err)
+		msg.Requeue(0)
+		return
+	}
+	msg.Finish()
+}
+
+// lookupdResponse is the subset of nsqlookupd's GET /lookup?topic=
+// response this Reader parses.
+type lookupdResponse struct {
+	Producers []struct {
+		BroadcastAddress string `json:"broadcast_address"`
+		TCPPort          int    `json:"tcp_port"`
+	} `json:"producers"`
+}
+
+// ConnectToLookupd registers addr as an nsqlookupd this Reader polls (every
+// DefaultLookupdPollInterval) for the topic's current producers, connecting
+// to any not already connected. The first call also performs an initial
+// synchronous lookup so callers see an immediate error for a bad addr.
+func (r *Reader) ConnectToLookupd(addr string) error {
+	r.mtx.Lock()
+	for _, existing := range r.lookupdHTTPAddrs {
+		if existing == addr {
+			r.mtx.Unlock()
+			return nil
+		}
+	}
+	r.lookupdHTTPAddrs = append(r.lookupdHTTPAddrs, addr)
+	r.mtx.Unlock()
+
+	if err := r.queryLookupd(addr); err != nil {
+		return err
+	}
+
+	if atomic.CompareAndSwapInt32(&r.lookupdStarted, 0, 1) {
+		r.lookupdTicker = time.NewTicker(DefaultLookupdPollInterval)
+		r.wg.Add(1)
+		go r.lookupdLoop()
+	}
+	return nil
+}
+
+func (r *Reader) lookupdLoop() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.lookupdTicker.C:
+			r.mtx.RLock()
+			addrs := append([]string(nil), r.lookupdHTTPAddrs...)
+			r.mtx.RUnlock()
+			for _, addr := range addrs {
+				if err := r.queryLookupd(addr); err != nil {
+					r.log(LogLevelError, "lookupd query failed for %s - %s", addr, err)
+				}
+			}
+		case <-r.stopChan:
+			r.lookupdTicker.Stop()
+			return
+		}
+	}
+}
+
+func (r *Reader) queryLookupd(addr string) error {
+	url := fmt.Sprintf("http://%s/lookup?topic=%s", addr, r.TopicName)
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		// no producers registered for this topic yet
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("lookupd %s returned status %d", addr, resp.StatusCode)
+	}
+
+	var parsed lookupdResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return err
+	}
+
+	for _, p := range parsed.Producers {
+		nsqdAddr := fmt.Sprintf("%s:%d", p.BroadcastAddress, p.TCPPort)
+		if err := r.ConnectToNSQ(nsqdAddr); err != nil {
+			r.log(LogLevelError, "failed to connect to %s discovered via %s - %s", nsqdAddr, addr, err)
+		}
+	}
+	return nil
+}
+
+// Stop gracefully closes every connection this Reader has open and stops
+// its lookupd polling loop, then closes ExitChan.
+func (r *Reader) Stop() {
+	if !atomic.CompareAndSwapInt32(&r.stopFlag, 0, 1) {
+		return
+	}
+
+	close(r.stopChan)
+
+	r.mtx.RLock()
+	conns := make([]*Conn, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mtx.RUnlock()
+
+	for _, c := range conns {
+		c.Stop()
+	}
+
+	r.wg.Wait()
+	close(r.ExitChan)
+}
@@ -1,14 +1,23 @@
 package nsq
 
 import (
-	"crypto/tls"
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// Writer connection states.
+const (
+	StateInit int32 = iota
+	StateConnected
+	StateDisconnected
+)
+
 // Writer is a high-level type to publish to NSQ.
 //
 // A Writer instance is 1:1 with a destination `nsqd`
@@ -16,37 +25,19 @@ import (
 // when Publish commands are executed.
 type Writer struct {
 	Addr string
+	cfg  *Config
 	conn *Conn
 
+	logger    Logger
+	logLvl    LogLevel
+	logPrefix string
+
 	responseChan  chan []byte
 	errorChan     chan []byte
 	ioErrorChan   chan error
 	heartbeatChan chan int
 	closeChan     chan int
 
-	// network deadlines
-	ReadTimeout  time.Duration // the deadline set for network reads
-	WriteTimeout time.Duration // the deadline set for network writes
-
-	ShortIdentifier string // an identifier to send to nsqd when connecting (defaults: short hostname)
-	LongIdentifier  string // an identifier to send to nsqd when connecting (defaults: long hostname)
-
-	HeartbeatInterval time.Duration // duration of time between heartbeats
-	UserAgent         string        // a string identifying the agent for this client in the spirit of HTTP (default: "<client_library_name>/<version>")
-
-	// transport layer security
-	TLSv1     bool        // negotiate enabling TLS
-	TLSConfig *tls.Config // client TLS configuration
-
-	// compression
-	Deflate      bool // negotiate enabling Deflate compression
-	DeflateLevel int  // the compression level to negotiate for Deflate
-	Snappy       bool // negotiate enabling Snappy compression
-
-	// output buffering
-	OutputBufferSize    int64         // size of the buffer (in bytes) used by nsqd for buffering writes to this connection
-	OutputBufferTimeout time.Duration // timeout (in ms) used by nsqd before flushing buffered writes (set to 0 to disable). Warning: configuring clients with an extremely low (< 25ms) output_buffer_timeout has a significant effect on nsqd CPU usage (particularly with > 50 clients connected).
-
 	concurrentWriters int32
 
 	transactionChan chan *WriterTransaction
@@ -55,6 +46,16 @@ type Writer struct {
 	stopFlag        int32
 	exitChan        chan int
 	wg              sync.WaitGroup
+
+	// ProtocolErrorCB, if set, is called when the connection receives a
+	// response/error frame with no outstanding transaction to match it
+	// against - a sign nsqd and the Writer have fallen out of sync.
+	ProtocolErrorCB func(w *Writer, err error)
+
+	inFlight  int64 // atomic - transactions queued or awaiting a response
+	published int64 // atomic - cumulative successful transactions
+	failed    int64 // atomic - cumulative failed transactions
+	lastRTT   int64 // atomic - time.Duration of the most recently completed transaction
 }
 
 // WriterTransaction is returned by the async publish methods
@@ -63,6 +64,7 @@ type Writer struct {
 type WriterTransaction struct {
 	cmd       *Command
 	doneChan  chan *WriterTransaction
+	sentAt    time.Time     // when the transaction was accepted onto the connection, for LastRTT
 	FrameType int32         // the frame type received in response to the publish command
 	Data      []byte        // the response data of the publish command
 	Error     error         // the error (or nil) of the publish command
@@ -81,10 +83,27 @@ var ErrNotConnected = errors.New("not connected")
 // returned when a publish command is made against a Writer that has been stopped
 var ErrStopped = errors.New("stopped")
 
-// NewWriter returns an instance of Writer for the specified address
-func NewWriter(addr string) *Writer {
+// returned by a publish command when the Writer already has Config.MaxInFlight
+// transactions queued or awaiting a response
+var ErrPublishQueueFull = errors.New("publish queue full")
+
+// reported via ProtocolErrorCB when a response/error frame arrives with no
+// outstanding transaction to match it against
+var ErrUnexpectedResponse = errors.New("unexpected response with no outstanding transaction")
+
+// NewWriter returns an instance of Writer for the specified address,
+// configured by cfg (which NewConfig's defaults if nil).
+func NewWriter(addr string, cfg *Config) *Writer {
+	if cfg == nil {
+		cfg = NewConfig()
+	}
 	return &Writer{
 		Addr: addr,
+		cfg:  cfg,
+
+		logger:    log.New(os.Stderr, "", log.LstdFlags),
+		logLvl:    LogLevelDebug,
+		logPrefix: fmt.Sprintf("(%s)", addr),
 
 		transactionChan: make(chan *WriterTransaction),
 		exitChan:        make(chan int),
@@ -101,6 +120,47 @@ func (w *Writer) String() string {
 	return w.Addr
 }
 
+// SetLogger assigns the logger to use, along with a level above which
+// messages are filtered out, and a string prefix that's prepended to every
+// line (the connection's address is always included too). Use NopLogger()
+// to silence the Writer entirely.
+func (w *Writer) SetLogger(logger Logger, lvl LogLevel, prefix string) {
+	w.logger = logger
+	w.logLvl = lvl
+	w.logPrefix = prefix
+}
+
+func (w *Writer) log(lvl LogLevel, line string, args ...interface{}) {
+	if w.logger == nil || lvl < w.logLvl {
+		return
+	}
+	w.logger.Output(2, fmt.Sprintf("%-4s %s [%s] %s", lvl, w.logPrefix, w, fmt.Sprintf(line, args...)))
+}
+
+// InFlight returns the number of transactions currently queued or awaiting
+// a response from nsqd.
+func (w *Writer) InFlight() int64 {
+	return atomic.LoadInt64(&w.inFlight)
+}
+
+// Published returns the cumulative count of transactions that completed
+// successfully.
+func (w *Writer) Published() int64 {
+	return atomic.LoadInt64(&w.published)
+}
+
+// Failed returns the cumulative count of transactions that completed with
+// an error (including ones abandoned due to disconnection).
+func (w *Writer) Failed() int64 {
+	return atomic.LoadInt64(&w.failed)
+}
+
+// LastRTT returns the round-trip time of the most recently completed
+// transaction.
+func (w *Writer) LastRTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&w.lastRTT))
+}
+
 // Stop disconnects and permanently stops the Writer
 func (w *Writer) Stop() {
 	if !atomic.CompareAndSwapInt32(&w.stopFlag, 0, 1) {
@@ -155,6 +215,31 @@ func (w *Writer) MultiPublish(topic string, body [][]byte) (int32, []byte, error
 	return w.sendCommand(cmd)
 }
 
+// PublishContext is Publish, abandoning the call with ctx.Err() if ctx is
+// done before the command is accepted or before nsqd responds.
+func (w *Writer) PublishContext(ctx context.Context, topic string, body []byte) (int32, []byte, error) {
+	return w.sendCommandContext(ctx, Publish(topic, body))
+}
+
+// MultiPublishContext is MultiPublish, abandoning the call with ctx.Err()
+// if ctx is done before the command is accepted or before nsqd responds.
+func (w *Writer) MultiPublishContext(ctx context.Context, topic string, body [][]byte) (int32, []byte, error) {
+	cmd, err := MultiPublish(topic, body)
+	if err != nil {
+		return -1, nil, err
+	}
+	return w.sendCommandContext(ctx, cmd)
+}
+
+// PublishAsyncContext is PublishAsync, abandoning the call with ctx.Err()
+// if ctx is done before the command is accepted onto the transaction queue.
+// Once accepted, the transaction is in flight the same as PublishAsync and
+// ctx no longer has any effect on it.
+func (w *Writer) PublishAsyncContext(ctx context.Context, topic string, body []byte,
+	doneChan chan *WriterTransaction, args ...interface{}) error {
+	return w.sendCommandAsyncContext(ctx, Publish(topic, body), doneChan, args)
+}
+
 func (w *Writer) sendCommand(cmd *Command) (int32, []byte, error) {
 	doneChan := make(chan *WriterTransaction)
 	err := w.sendCommandAsync(cmd, doneChan, nil)
@@ -166,6 +251,49 @@ func (w *Writer) sendCommand(cmd *Command) (int32, []byte, error) {
 	return t.FrameType, t.Data, t.Error
 }
 
+// sendCommandContext is sendCommand, but gives up waiting for the response
+// once ctx is done. doneChan is buffered so that the eventual response -
+// popped off w.transactions by router() - can still be delivered into it
+// without blocking router() forever on an abandoned receiver.
+func (w *Writer) sendCommandContext(ctx context.Context, cmd *Command) (int32, []byte, error) {
+	doneChan := make(chan *WriterTransaction, 1)
+	err := w.sendCommandAsyncContext(ctx, cmd, doneChan, nil)
+	if err != nil {
+		return -1, nil, err
+	}
+	select {
+	case t := <-doneChan:
+		return t.FrameType, t.Data, t.Error
+	case <-ctx.Done():
+		return -1, nil, ctx.Err()
+	}
+}
+
+// reserveInFlight atomically claims a slot against Config.MaxInFlight,
+// returning ErrPublishQueueFull if the Writer is already at capacity. A
+// reserved slot must be released with releaseInFlight if the transaction
+// never ends up being handed to router() (e.g. a failed/cancelled send).
+func (w *Writer) reserveInFlight() error {
+	maxInFlight := int64(w.cfg.MaxInFlight)
+	if maxInFlight <= 0 {
+		atomic.AddInt64(&w.inFlight, 1)
+		return nil
+	}
+	for {
+		cur := atomic.LoadInt64(&w.inFlight)
+		if cur >= maxInFlight {
+			return ErrPublishQueueFull
+		}
+		if atomic.CompareAndSwapInt64(&w.inFlight, cur, cur+1) {
+			return nil
+		}
+	}
+}
+
+func (w *Writer) releaseInFlight() {
+	atomic.AddInt64(&w.inFlight, -1)
+}
+
 func (w *Writer) sendCommandAsync(cmd *Command, doneChan chan *WriterTransaction,
 	args []interface{}) error {
 	// keep track of how many outstanding writers we're dealing with
@@ -180,9 +308,14 @@ func (w *Writer) sendCommandAsync(cmd *Command, doneChan chan *WriterTransaction
 		}
 	}
 
+	if err := w.reserveInFlight(); err != nil {
+		return err
+	}
+
 	t := &WriterTransaction{
 		cmd:       cmd,
 		doneChan:  doneChan,
+		sentAt:    time.Now(),
 		FrameType: -1,
 		Args:      args,
 	}
@@ -190,12 +323,52 @@ func (w *Writer) sendCommandAsync(cmd *Command, doneChan chan *WriterTransaction
 	select {
 	case w.transactionChan <- t:
 	case <-w.exitChan:
+		w.releaseInFlight()
 		return ErrStopped
 	}
 
 	return nil
 }
 
+func (w *Writer) sendCommandAsyncContext(ctx context.Context, cmd *Command,
+	doneChan chan *WriterTransaction, args []interface{}) error {
+	// keep track of how many outstanding writers we're dealing with
+	// in order to later ensure that we clean them all up...
+	atomic.AddInt32(&w.concurrentWriters, 1)
+	defer atomic.AddInt32(&w.concurrentWriters, -1)
+
+	if atomic.LoadInt32(&w.state) != StateConnected {
+		err := w.connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := w.reserveInFlight(); err != nil {
+		return err
+	}
+
+	t := &WriterTransaction{
+		cmd:       cmd,
+		doneChan:  doneChan,
+		sentAt:    time.Now(),
+		FrameType: -1,
+		Args:      args,
+	}
+
+	select {
+	case w.transactionChan <- t:
+	case <-w.exitChan:
+		w.releaseInFlight()
+		return ErrStopped
+	case <-ctx.Done():
+		w.releaseInFlight()
+		return ctx.Err()
+	}
+
+	return nil
+}
+
 func (w *Writer) connect() error {
 	if atomic.LoadInt32(&w.stopFlag) == 1 {
 		return ErrStopped
@@ -205,39 +378,49 @@ func (w *Writer) connect() error {
 		return ErrNotConnected
 	}
 
-	log.Printf("[%s] connecting...", w)
+	if err := w.cfg.Validate(); err != nil {
+		atomic.StoreInt32(&w.state, StateInit)
+		return err
+	}
+	w.cfg.freeze()
+
+	w.log(LogLevelInfo, "connecting...")
 
 	conn := NewConn(w.Addr, "", "")
-	if w.ReadTimeout > 0 {
-		conn.ReadTimeout = w.ReadTimeout
+	conn.SetLogger(w.logger, w.logLvl, w.logPrefix)
+	if w.cfg.Transport == TransportWebSocket {
+		conn.Dialer = &webSocketDialer{addr: w.Addr, tlsConfig: w.cfg.TLSConfig}
+	}
+	if w.cfg.ReadTimeout > 0 {
+		conn.ReadTimeout = w.cfg.ReadTimeout
 	}
-	if w.WriteTimeout > 0 {
-		conn.WriteTimeout = w.WriteTimeout
+	if w.cfg.WriteTimeout > 0 {
+		conn.WriteTimeout = w.cfg.WriteTimeout
 	}
-	conn.Deflate = w.Deflate
-	if w.DeflateLevel > 0 {
-		conn.DeflateLevel = w.DeflateLevel
+	conn.Deflate = w.cfg.Deflate
+	if w.cfg.DeflateLevel > 0 {
+		conn.DeflateLevel = w.cfg.DeflateLevel
 	}
-	conn.Snappy = w.Snappy
-	conn.TLSv1 = w.TLSv1
-	conn.TLSConfig = w.TLSConfig
-	if w.ShortIdentifier != "" {
-		conn.ShortIdentifier = w.ShortIdentifier
+	conn.Snappy = w.cfg.Snappy
+	conn.TLSv1 = w.cfg.TLSv1
+	conn.TLSConfig = w.cfg.TLSConfig
+	if w.cfg.ShortIdentifier != "" {
+		conn.ShortIdentifier = w.cfg.ShortIdentifier
 	}
-	if w.LongIdentifier != "" {
-		conn.LongIdentifier = w.LongIdentifier
+	if w.cfg.LongIdentifier != "" {
+		conn.LongIdentifier = w.cfg.LongIdentifier
 	}
-	if w.HeartbeatInterval != 0 {
-		conn.HeartbeatInterval = w.HeartbeatInterval
+	if w.cfg.HeartbeatInterval != 0 {
+		conn.HeartbeatInterval = w.cfg.HeartbeatInterval
 	}
-	if w.OutputBufferSize != 0 {
-		conn.OutputBufferSize = w.OutputBufferSize
+	if w.cfg.OutputBufferSize != 0 {
+		conn.OutputBufferSize = w.cfg.OutputBufferSize
 	}
-	if w.OutputBufferTimeout != 0 {
-		conn.OutputBufferTimeout = w.OutputBufferTimeout
+	if w.cfg.OutputBufferTimeout != 0 {
+		conn.OutputBufferTimeout = w.cfg.OutputBufferTimeout
 	}
-	if w.UserAgent != "" {
-		conn.UserAgent = w.UserAgent
+	if w.cfg.UserAgent != "" {
+		conn.UserAgent = w.cfg.UserAgent
 	}
 
 	conn.ResponseCB = func(c *Conn, data []byte) {
@@ -263,21 +446,21 @@ func (w *Writer) connect() error {
 	resp, err := conn.Connect()
 	if err != nil {
 		conn.Close()
-		log.Printf("ERROR: [%s] failed to IDENTIFY - %s", w, err)
+		w.log(LogLevelError, "failed to IDENTIFY - %s", err)
 		atomic.StoreInt32(&w.state, StateInit)
 		return err
 	}
 
 	if resp != nil {
-		log.Printf("[%s] IDENTIFY response: %+v", w, resp)
+		w.log(LogLevelDebug, "IDENTIFY response: %+v", resp)
 		if resp.TLSv1 {
-			log.Printf("[%s] upgrading to TLS", w)
+			w.log(LogLevelInfo, "upgrading to TLS")
 		}
 		if resp.Deflate {
-			log.Printf("[%s] upgrading to Deflate", w)
+			w.log(LogLevelInfo, "upgrading to Deflate")
 		}
 		if resp.Snappy {
-			log.Printf("[%s] upgrading to Snappy", w)
+			w.log(LogLevelInfo, "upgrading to Snappy")
 		}
 	}
 
@@ -309,7 +492,7 @@ func (w *Writer) router() {
 			w.transactions = append(w.transactions, t)
 			err := w.conn.SendCommand(t.cmd)
 			if err != nil {
-				log.Printf("ERROR: [%s] failed writing %s", w, err)
+				w.log(LogLevelError, "failed writing %s", err)
 				w.close()
 			}
 		case data := <-w.responseChan:
@@ -317,9 +500,9 @@ func (w *Writer) router() {
 		case data := <-w.errorChan:
 			w.popTransaction(FrameTypeError, data)
 		case <-w.heartbeatChan:
-			log.Printf("[%s] heartbeat received", w)
+			w.log(LogLevelDebug, "heartbeat received")
 		case err := <-w.ioErrorChan:
-			log.Printf("ERROR: [%s] %s", w, err)
+			w.log(LogLevelError, "%s", err)
 			w.close()
 		case <-w.closeChan:
 			goto exit
@@ -331,12 +514,26 @@ func (w *Writer) router() {
 exit:
 	w.transactionCleanup()
 	w.wg.Done()
-	log.Printf("[%s] exiting messageRouter()", w)
+	w.log(LogLevelInfo, "exiting messageRouter()")
 }
 
 func (w *Writer) popTransaction(frameType int32, data []byte) {
+	if len(w.transactions) == 0 {
+		w.log(LogLevelError, "%s", ErrUnexpectedResponse)
+		if w.ProtocolErrorCB != nil {
+			w.ProtocolErrorCB(w, ErrUnexpectedResponse)
+		}
+		return
+	}
 	t := w.transactions[0]
 	w.transactions = w.transactions[1:]
+	w.releaseInFlight()
+	atomic.StoreInt64(&w.lastRTT, int64(time.Since(t.sentAt)))
+	if frameType == FrameTypeError {
+		atomic.AddInt64(&w.failed, 1)
+	} else {
+		atomic.AddInt64(&w.published, 1)
+	}
 	t.FrameType = frameType
 	t.Data = data
 	t.Error = nil
@@ -347,6 +544,8 @@ func (w *Writer) transactionCleanup() {
 	// clean up transactions we can easily account for
 	for _, t := range w.transactions {
 		t.Error = ErrNotConnected
+		w.releaseInFlight()
+		atomic.AddInt64(&w.failed, 1)
 		t.finish()
 	}
 	w.transactions = w.transactions[:0]
@@ -358,6 +557,8 @@ func (w *Writer) transactionCleanup() {
 		select {
 		case t := <-w.transactionChan:
 			t.Error = ErrNotConnected
+			w.releaseInFlight()
+			atomic.AddInt64(&w.failed, 1)
 			t.finish()
 		default:
 			// keep spinning until there are 0 concurrent writers
@@ -0,0 +1,303 @@
+package nsq
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy selects how a WriterPool picks among its healthy Writers.
+type Strategy int
+
+const (
+	// RoundRobin cycles through healthy writers in order.
+	RoundRobin Strategy = iota
+	// Random picks a healthy writer uniformly at random.
+	Random
+)
+
+// DefaultHealthCheckInterval is how often a WriterPool probes unhealthy
+// writers' addresses to decide whether they can rejoin rotation.
+const DefaultHealthCheckInterval = 15 * time.Second
+
+// ErrNoWriters is returned when a WriterPool has no writers to publish with.
+var ErrNoWriters = errors.New("no writers available")
+
+// writerPoolEntry tracks one pooled Writer's health.
+type writerPoolEntry struct {
+	writer  *Writer
+	healthy int32 // atomic bool
+}
+
+// WriterPool fans Publish/PublishAsync/MultiPublish out across multiple
+// Writer instances - one per destination nsqd - so callers don't have to
+// implement their own distribution across a cluster. It fails over away
+// from writers that return ErrNotConnected/ErrStopped or an IO error, and
+// can refresh its set of destination nsqds from an nsqlookupd discovery
+// hook rather than a fixed address list.
+type WriterPool struct {
+	strategy Strategy
+	cfg      *Config
+
+	mu      sync.RWMutex
+	entries map[string]*writerPoolEntry
+
+	rrCounter uint64
+
+	healthCheckInterval time.Duration
+	stopChan            chan int
+	stopOnce            sync.Once
+}
+
+// NewWriterPool returns a WriterPool that publishes to addrs using the
+// given selection strategy, connecting every pooled Writer with cfg
+// (NewConfig's defaults if nil).
+func NewWriterPool(addrs []string, strategy Strategy, cfg *Config) *WriterPool {
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+	p := &WriterPool{
+		strategy:            strategy,
+		cfg:                 cfg,
+		entries:             make(map[string]*writerPoolEntry),
+		healthCheckInterval: DefaultHealthCheckInterval,
+		stopChan:            make(chan int),
+	}
+	for _, addr := range addrs {
+		p.addWriter(addr)
+	}
+	go p.healthCheckLoop()
+	return p
+}
+
+func (p *WriterPool) addWriter(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.entries[addr]; ok {
+		return
+	}
+	p.entries[addr] = &writerPoolEntry{writer: NewWriter(addr, p.cfg), healthy: 1}
+}
+
+func (p *WriterPool) removeWriter(addr string) {
+	p.mu.Lock()
+	e, ok := p.entries[addr]
+	if ok {
+		delete(p.entries, addr)
+	}
+	p.mu.Unlock()
+	if ok {
+		e.writer.Stop()
+	}
+}
+
+// SetLookupd starts a background loop that calls discover every interval
+// and reconciles the pool's writers with the returned nsqd addresses -
+// adding writers for newly-discovered addresses and stopping/removing
+// writers for addresses that disappeared.
+func (p *WriterPool) SetLookupd(discover func() ([]string, error), interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				addrs, err := discover()
+				if err != nil {
+					log.Printf("ERROR: WriterPool lookupd discovery failed - %s", err)
+					continue
+				}
+				p.reconcile(addrs)
+			case <-p.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (p *WriterPool) reconcile(addrs []string) {
+	want := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		want[addr] = true
+		p.addWriter(addr)
+	}
+
+	p.mu.RLock()
+	var stale []string
+	for addr := range p.entries {
+		if !want[addr] {
+			stale = append(stale, addr)
+		}
+	}
+	p.mu.RUnlock()
+
+	for _, addr := range stale {
+		p.removeWriter(addr)
+	}
+}
+
+func (p *WriterPool) healthCheckLoop() {
+	ticker := time.NewTicker(p.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.healthCheck()
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+// healthCheck probes every unhealthy writer's address with a bare TCP dial
+// (independent of the writer's own lazily-established connection) and
+// marks it healthy again on success, so it rejoins rotation.
+func (p *WriterPool) healthCheck() {
+	p.mu.RLock()
+	entries := make([]*writerPoolEntry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, e)
+	}
+	p.mu.RUnlock()
+
+	for _, e := range entries {
+		if atomic.LoadInt32(&e.healthy) == 1 {
+			continue
+		}
+		conn, err := net.DialTimeout("tcp", e.writer.Addr, time.Second)
+		if err == nil {
+			conn.Close()
+			atomic.StoreInt32(&e.healthy, 1)
+		}
+	}
+}
+
+func (p *WriterPool) markUnhealthy(addr string) {
+	p.mu.RLock()
+	e, ok := p.entries[addr]
+	p.mu.RUnlock()
+	if ok {
+		atomic.StoreInt32(&e.healthy, 0)
+	}
+}
+
+// healthyWriters returns a snapshot of the currently healthy writers,
+// sorted by address so RoundRobin's incrementing index walks a stable
+// order instead of the randomized order map iteration would otherwise
+// produce on every call.
+func (p *WriterPool) healthyWriters() []*Writer {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	writers := make([]*Writer, 0, len(p.entries))
+	for _, e := range p.entries {
+		if atomic.LoadInt32(&e.healthy) == 1 {
+			writers = append(writers, e.writer)
+		}
+	}
+	sort.Sort(writersByAddr(writers))
+	return writers
+}
+
+// writersByAddr sorts []*Writer by Addr.
+type writersByAddr []*Writer
+
+func (w writersByAddr) Len() int           { return len(w) }
+func (w writersByAddr) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+func (w writersByAddr) Less(i, j int) bool { return w[i].Addr < w[j].Addr }
+
+// pick selects one healthy writer according to the pool's Strategy.
+func (p *WriterPool) pick() (*Writer, error) {
+	writers := p.healthyWriters()
+	if len(writers) == 0 {
+		return nil, ErrNoWriters
+	}
+	switch p.strategy {
+	case Random:
+		return writers[rand.Intn(len(writers))], nil
+	default:
+		n := atomic.AddUint64(&p.rrCounter, 1)
+		return writers[int(n)%len(writers)], nil
+	}
+}
+
+func isFailoverErr(err error) bool {
+	if err == ErrNotConnected || err == ErrStopped {
+		return true
+	}
+	_, ok := err.(*net.OpError)
+	return ok
+}
+
+// publish calls fn against healthy writers in turn, failing over whenever
+// fn's error indicates the writer itself is the problem, until one
+// succeeds or every healthy writer has been tried.
+func (p *WriterPool) publish(fn func(w *Writer) (int32, []byte, error)) (int32, []byte, error) {
+	attempts := len(p.healthyWriters())
+	if attempts == 0 {
+		return -1, nil, ErrNoWriters
+	}
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		w, err := p.pick()
+		if err != nil {
+			return -1, nil, err
+		}
+		frameType, data, err := fn(w)
+		if err == nil {
+			return frameType, data, nil
+		}
+		if isFailoverErr(err) {
+			p.markUnhealthy(w.Addr)
+			lastErr = err
+			continue
+		}
+		return frameType, data, err
+	}
+	return -1, nil, lastErr
+}
+
+// Publish synchronously publishes body to topic via one of the pool's
+// writers, failing over to another on a writer-level error.
+func (p *WriterPool) Publish(topic string, body []byte) (int32, []byte, error) {
+	return p.publish(func(w *Writer) (int32, []byte, error) {
+		return w.Publish(topic, body)
+	})
+}
+
+// MultiPublish synchronously publishes body to topic via one of the pool's
+// writers, failing over to another on a writer-level error.
+func (p *WriterPool) MultiPublish(topic string, body [][]byte) (int32, []byte, error) {
+	return p.publish(func(w *Writer) (int32, []byte, error) {
+		return w.MultiPublish(topic, body)
+	})
+}
+
+// PublishAsync publishes body to topic via one of the pool's writers
+// without waiting for the response; see Writer.PublishAsync.
+func (p *WriterPool) PublishAsync(topic string, body []byte, doneChan chan *WriterTransaction, args ...interface{}) error {
+	w, err := p.pick()
+	if err != nil {
+		return err
+	}
+	return w.PublishAsync(topic, body, doneChan, args...)
+}
+
+// Stop stops every writer in the pool and the background discovery/health
+// check loops.
+func (p *WriterPool) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, e := range p.entries {
+		e.writer.Stop()
+	}
+}
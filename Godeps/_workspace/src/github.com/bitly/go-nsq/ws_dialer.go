@@ -0,0 +1,86 @@
+package nsq
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// webSocketDialer dials a ws:// or wss:// URL and wraps the resulting
+// WebSocket connection in a net.Conn adapter so Conn can speak the NSQ
+// binary protocol over it unmodified. It requires a companion proxy in
+// front of nsqd that terminates the WebSocket and relays binary message
+// payloads to/from nsqd's TCP port.
+type webSocketDialer struct {
+	addr      string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+}
+
+func (d *webSocketDialer) Dial(ctx context.Context) (net.Conn, error) {
+	u, err := url.Parse(d.addr)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: d.timeout,
+		TLSClientConfig:  d.tlsConfig,
+	}
+	ws, _, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return newWSConn(ws), nil
+}
+
+// wsConn adapts a *websocket.Conn exchanging binary messages into a
+// net.Conn presenting a contiguous byte stream - the same shape the rest
+// of Conn already reads/writes against a raw TCP socket.
+type wsConn struct {
+	ws  *websocket.Conn
+	buf bytes.Buffer
+}
+
+func newWSConn(ws *websocket.Conn) *wsConn {
+	return &wsConn{ws: ws}
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.buf.Write(data)
+	}
+	return c.buf.Read(b)
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr  { return c.ws.LocalAddr() }
+func (c *wsConn) RemoteAddr() net.Addr { return c.ws.RemoteAddr() }
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *wsConn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
@@ -0,0 +1,756 @@
+// Package clusterinfo replaces the old lookupd package: it exposes the same
+// cluster-query functionality (topics, channels, producers, nsqd stats) as
+// methods on a ClusterInfo type instead of free functions, and adds the
+// mutating operations lookupd never supported - tombstoning a node out of a
+// topic, deleting topics/channels cluster-wide, and pausing topics.
+package clusterinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/bitly/nsq/util"
+	"github.com/bitly/nsq/util/httpclient"
+	"github.com/bitly/nsq/util/semver"
+)
+
+// Logger is satisfied by *log.Logger; it's accepted as an interface so
+// callers can route ClusterInfo's output through their own logging setup.
+type Logger interface {
+	Printf(f string, args ...interface{})
+}
+
+// ClusterInfo provides access to nsqlookupd/nsqd cluster metadata and
+// administrative operations over HTTP.
+type ClusterInfo struct {
+	httpClient *httpclient.Client
+	log        Logger
+}
+
+// New returns a ClusterInfo that issues requests with httpClient (constructing
+// a default one via httpclient.NewClient(nil) if none is given) and logs
+// through log (if non-nil).
+func New(log Logger, httpClient *httpclient.Client) *ClusterInfo {
+	if httpClient == nil {
+		httpClient = httpclient.NewClient(nil)
+	}
+	return &ClusterInfo{httpClient: httpClient, log: log}
+}
+
+func (c *ClusterInfo) logf(f string, args ...interface{}) {
+	if c.log == nil {
+		return
+	}
+	c.log.Printf(f, args...)
+}
+
+// PartialErr aggregates the errors encountered while fanning a request out
+// to multiple lookupd/nsqd instances, so a caller can distinguish "every
+// node failed" from "some nodes failed" instead of collapsing both to a
+// single boolean.
+type PartialErr []error
+
+func (p PartialErr) Error() string {
+	errs := make([]string, len(p))
+	for i, e := range p {
+		errs[i] = e.Error()
+	}
+	return strings.Join(errs, "; ")
+}
+
+// GetVersion queries addr's /info endpoint and parses the returned version
+// string with semver, so callers can negotiate behavior that varies across
+// nsqd/nsqlookupd releases.
+func (c *ClusterInfo) GetVersion(addr string) (semver.Version, error) {
+	endpoint := fmt.Sprintf("http://%s/info", addr)
+	c.logf("CLUSTERINFO: querying %s", endpoint)
+
+	var info struct {
+		Version string `json:"version"`
+	}
+	if _, err := c.httpClient.GETV1(endpoint, &info); err != nil {
+		return semver.Version{}, err
+	}
+	if info.Version == "" {
+		info.Version = "0.0.0"
+	}
+	return semver.Parse(info.Version)
+}
+
+// post issues a bodiless, content-negotiated POST to endpoint via the
+// shared httpclient.Client, which returns non-2xx responses as an error
+// rather than logging and discarding them.
+func (c *ClusterInfo) post(endpoint string) error {
+	_, err := c.httpClient.POSTV1(endpoint, nil)
+	return err
+}
+
+// fanOutPost issues post(endpoint) against every addr, returning a PartialErr
+// of whatever failed (nil if every request succeeded).
+func (c *ClusterInfo) fanOutPost(addrs []string, path string, query string) error {
+	var lock sync.Mutex
+	var errs PartialErr
+
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		endpoint := fmt.Sprintf("http://%s%s?%s", addr, path, query)
+		c.logf("CLUSTERINFO: querying %s", endpoint)
+
+		go func(endpoint string) {
+			defer wg.Done()
+			if err := c.post(endpoint); err != nil {
+				lock.Lock()
+				errs = append(errs, err)
+				lock.Unlock()
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// minTombstonePauseVersion is the oldest nsqlookupd version that answers
+// /topic/tombstone, /topic/pause, and /topic/unpause - every release before
+// it 404s instead of tombstoning/pausing, so fanOutPostVersioned skips them
+// rather than counting an expected 404 as a cluster failure.
+var minTombstonePauseVersion, _ = semver.Parse("0.2.28")
+
+// fanOutPostVersioned is fanOutPost, but first calls GetVersion on each addr
+// and only POSTs to the ones reporting minVersion or newer. Addrs an older
+// lookupd doesn't support the operation on are recorded in the returned
+// PartialErr instead of being POSTed to and failing with a 404.
+func (c *ClusterInfo) fanOutPostVersioned(addrs []string, minVersion semver.Version, path string, query string) error {
+	var errs PartialErr
+	supported := make([]string, 0, len(addrs))
+
+	for _, addr := range addrs {
+		version, err := c.GetVersion(addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to determine version - %s", addr, err))
+			continue
+		}
+		if version.Less(minVersion) {
+			errs = append(errs, fmt.Errorf("%s: version %s does not support %s (requires %s+)", addr, version, path, minVersion))
+			continue
+		}
+		supported = append(supported, addr)
+	}
+
+	if err := c.fanOutPost(supported, path, query); err != nil {
+		if pe, ok := err.(PartialErr); ok {
+			errs = append(errs, pe...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// TombstoneNodeForTopic tombstones node out of topic on every lookupd in
+// lookupdHTTPAddrs, so it stops being returned as a producer for that topic.
+func (c *ClusterInfo) TombstoneNodeForTopic(topic string, node string, lookupdHTTPAddrs []string) error {
+	query := fmt.Sprintf("topic=%s&node=%s", url.QueryEscape(topic), url.QueryEscape(node))
+	return c.fanOutPostVersioned(lookupdHTTPAddrs, minTombstonePauseVersion, "/topic/tombstone", query)
+}
+
+// PauseTopic pauses topic on every lookupd in lookupdHTTPAddrs.
+func (c *ClusterInfo) PauseTopic(topic string, lookupdHTTPAddrs []string) error {
+	query := fmt.Sprintf("topic=%s", url.QueryEscape(topic))
+	return c.fanOutPostVersioned(lookupdHTTPAddrs, minTombstonePauseVersion, "/topic/pause", query)
+}
+
+// UnpauseTopic unpauses topic on every lookupd in lookupdHTTPAddrs.
+func (c *ClusterInfo) UnpauseTopic(topic string, lookupdHTTPAddrs []string) error {
+	query := fmt.Sprintf("topic=%s", url.QueryEscape(topic))
+	return c.fanOutPostVersioned(lookupdHTTPAddrs, minTombstonePauseVersion, "/topic/unpause", query)
+}
+
+// GetLookupdTopicProducers returns the broadcast_address:http_port of every
+// producer of topic, as reported by any of lookupdHTTPAddrs.
+func (c *ClusterInfo) GetLookupdTopicProducers(topic string, lookupdHTTPAddrs []string) ([]string, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs PartialErr
+	allSources := make([]string, 0)
+	success := false
+
+	for _, addr := range lookupdHTTPAddrs {
+		wg.Add(1)
+		endpoint := fmt.Sprintf("http://%s/lookup?topic=%s", addr, url.QueryEscape(topic))
+		c.logf("CLUSTERINFO: querying %s", endpoint)
+
+		go func(endpoint string) {
+			defer wg.Done()
+			var resp struct {
+				Producers []struct {
+					BroadcastAddress string `json:"broadcast_address"`
+					HTTPPort         int    `json:"http_port"`
+				} `json:"producers"`
+			}
+			_, err := c.httpClient.GETV1(endpoint, &resp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				c.logf("ERROR: lookupd %s - %s", endpoint, err.Error())
+				errs = append(errs, fmt.Errorf("%s: %s", endpoint, err))
+				return
+			}
+			success = true
+			for _, producer := range resp.Producers {
+				allSources = util.StringAdd(allSources, fmt.Sprintf("%s:%d", producer.BroadcastAddress, producer.HTTPPort))
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+
+	if !success {
+		return nil, errs
+	}
+	return allSources, nil
+}
+
+// DeleteTopic deletes topic from every lookupd in lookupdHTTPAddrs, and then
+// from every nsqd currently producing it (discovered via
+// GetLookupdTopicProducers), so the delete actually reaches the data rather
+// than just the registry.
+func (c *ClusterInfo) DeleteTopic(topic string, lookupdHTTPAddrs []string) error {
+	var errs PartialErr
+
+	query := fmt.Sprintf("topic=%s", url.QueryEscape(topic))
+	if err := c.fanOutPost(lookupdHTTPAddrs, "/delete_topic", query); err != nil {
+		if pe, ok := err.(PartialErr); ok {
+			errs = append(errs, pe...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	producers, err := c.GetLookupdTopicProducers(topic, lookupdHTTPAddrs)
+	if err != nil {
+		errs = append(errs, err)
+	} else if err := c.fanOutPost(producers, "/delete_topic", query); err != nil {
+		if pe, ok := err.(PartialErr); ok {
+			errs = append(errs, pe...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// DeleteChannel deletes channel of topic from every lookupd in
+// lookupdHTTPAddrs, and then from every nsqd currently producing topic.
+func (c *ClusterInfo) DeleteChannel(topic string, channel string, lookupdHTTPAddrs []string) error {
+	var errs PartialErr
+
+	query := fmt.Sprintf("topic=%s&channel=%s", url.QueryEscape(topic), url.QueryEscape(channel))
+	if err := c.fanOutPost(lookupdHTTPAddrs, "/delete_channel", query); err != nil {
+		if pe, ok := err.(PartialErr); ok {
+			errs = append(errs, pe...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	producers, err := c.GetLookupdTopicProducers(topic, lookupdHTTPAddrs)
+	if err != nil {
+		errs = append(errs, err)
+	} else if err := c.fanOutPost(producers, "/delete_channel", query); err != nil {
+		if pe, ok := err.(PartialErr); ok {
+			errs = append(errs, pe...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// GetLookupdTopics returns a []string containing a union of all the topics
+// from all the given lookupd.
+func (c *ClusterInfo) GetLookupdTopics(lookupdHTTPAddrs []string) ([]string, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs PartialErr
+	allTopics := make([]string, 0)
+	success := false
+
+	for _, addr := range lookupdHTTPAddrs {
+		wg.Add(1)
+		endpoint := fmt.Sprintf("http://%s/topics", addr)
+		c.logf("CLUSTERINFO: querying %s", endpoint)
+
+		go func(endpoint string) {
+			defer wg.Done()
+			var resp struct {
+				Topics []string `json:"topics"`
+			}
+			_, err := c.httpClient.GETV1(endpoint, &resp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				c.logf("ERROR: lookupd %s - %s", endpoint, err.Error())
+				errs = append(errs, fmt.Errorf("%s: %s", endpoint, err))
+				return
+			}
+			success = true
+			allTopics = util.StringUnion(allTopics, resp.Topics)
+		}(endpoint)
+	}
+	wg.Wait()
+	sort.Strings(allTopics)
+	if !success {
+		return nil, errs
+	}
+	return allTopics, nil
+}
+
+// GetLookupdTopicChannels returns a []string containing a union of the
+// channels from all the given lookupd for the given topic.
+func (c *ClusterInfo) GetLookupdTopicChannels(topic string, lookupdHTTPAddrs []string) ([]string, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs PartialErr
+	allChannels := make([]string, 0)
+	success := false
+
+	for _, addr := range lookupdHTTPAddrs {
+		wg.Add(1)
+		endpoint := fmt.Sprintf("http://%s/channels?topic=%s", addr, url.QueryEscape(topic))
+		c.logf("CLUSTERINFO: querying %s", endpoint)
+
+		go func(endpoint string) {
+			defer wg.Done()
+			var resp struct {
+				Channels []string `json:"channels"`
+			}
+			_, err := c.httpClient.GETV1(endpoint, &resp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				c.logf("ERROR: lookupd %s - %s", endpoint, err.Error())
+				errs = append(errs, fmt.Errorf("%s: %s", endpoint, err))
+				return
+			}
+			success = true
+			allChannels = util.StringUnion(allChannels, resp.Channels)
+		}(endpoint)
+	}
+	wg.Wait()
+	sort.Strings(allChannels)
+	if !success {
+		return nil, errs
+	}
+	return allChannels, nil
+}
+
+// GetLookupdProducers returns a slice of pointers to util.Producer structs
+// containing metadata for each node connected to the given lookupds.
+func (c *ClusterInfo) GetLookupdProducers(lookupdHTTPAddrs []string) ([]*util.Producer, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs PartialErr
+	allProducers := make(map[string]*util.Producer)
+	output := make([]*util.Producer, 0)
+	maxVersion, _ := semver.Parse("0.0.0")
+	success := false
+
+	for _, addr := range lookupdHTTPAddrs {
+		wg.Add(1)
+		endpoint := fmt.Sprintf("http://%s/nodes", addr)
+		c.logf("CLUSTERINFO: querying %s", endpoint)
+
+		go func(addr string, endpoint string) {
+			defer wg.Done()
+			var resp struct {
+				Producers []struct {
+					RemoteAddress    string   `json:"remote_address"`
+					Hostname         string   `json:"hostname"`
+					BroadcastAddress string   `json:"broadcast_address"`
+					HTTPPort         int      `json:"http_port"`
+					TCPPort          int      `json:"tcp_port"`
+					Version          string   `json:"version"`
+					Tombstones       []bool   `json:"tombstones"`
+					Topics           []string `json:"topics"`
+				} `json:"producers"`
+			}
+			_, err := c.httpClient.GETV1(endpoint, &resp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				c.logf("ERROR: lookupd %s - %s", endpoint, err.Error())
+				errs = append(errs, fmt.Errorf("%s: %s", endpoint, err))
+				return
+			}
+			success = true
+
+			for _, producer := range resp.Producers {
+				remoteAddress := producer.RemoteAddress
+				if remoteAddress == "" {
+					remoteAddress = "NA"
+				}
+				key := fmt.Sprintf("%s:%d:%d", producer.BroadcastAddress, producer.HTTPPort, producer.TCPPort)
+				p, ok := allProducers[key]
+				if !ok {
+					tombstones := producer.Tombstones
+					if len(tombstones) == 0 {
+						// backwards compatibility with nsqlookupd < v0.2.22
+						tombstones = make([]bool, len(producer.Topics))
+					}
+
+					var topics util.ProducerTopics
+					for i, t := range producer.Topics {
+						topics = append(topics, util.ProducerTopic{
+							Topic:      t,
+							Tombstoned: tombstones[i],
+						})
+					}
+					sort.Sort(topics)
+
+					version := producer.Version
+					if version == "" {
+						version = "unknown"
+					}
+					versionObj, err := semver.Parse(version)
+					if err != nil {
+						versionObj = maxVersion
+					}
+					if maxVersion.Less(versionObj) {
+						maxVersion = versionObj
+					}
+
+					p = &util.Producer{
+						Hostname:         producer.Hostname,
+						BroadcastAddress: producer.BroadcastAddress,
+						TcpPort:          producer.TCPPort,
+						HttpPort:         producer.HTTPPort,
+						Version:          version,
+						VersionObj:       versionObj,
+						Topics:           topics,
+					}
+					allProducers[key] = p
+					output = append(output, p)
+				}
+				p.RemoteAddresses = append(p.RemoteAddresses, fmt.Sprintf("%s/%s", addr, remoteAddress))
+			}
+		}(addr, endpoint)
+	}
+	wg.Wait()
+	for _, producer := range output {
+		if producer.VersionObj.Less(maxVersion) {
+			producer.OutOfDate = true
+		}
+	}
+	sort.Sort(util.ProducersByHost{Producers: output})
+	if !success {
+		return nil, errs
+	}
+	return output, nil
+}
+
+// GetNSQDTopics returns a []string containing all the topics produced by the
+// given nsqd.
+func (c *ClusterInfo) GetNSQDTopics(nsqdHTTPAddrs []string) ([]string, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs PartialErr
+	topics := make([]string, 0)
+	success := false
+
+	for _, addr := range nsqdHTTPAddrs {
+		wg.Add(1)
+		endpoint := fmt.Sprintf("http://%s/stats?format=json", addr)
+		c.logf("CLUSTERINFO: querying %s", endpoint)
+
+		go func(endpoint string) {
+			defer wg.Done()
+			var resp struct {
+				Topics []struct {
+					TopicName string `json:"topic_name"`
+				} `json:"topics"`
+			}
+			_, err := c.httpClient.GETV1(endpoint, &resp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				c.logf("ERROR: nsqd %s - %s", endpoint, err.Error())
+				errs = append(errs, fmt.Errorf("%s: %s", endpoint, err))
+				return
+			}
+			success = true
+			for _, t := range resp.Topics {
+				topics = util.StringAdd(topics, t.TopicName)
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+	sort.Strings(topics)
+	if !success {
+		return nil, errs
+	}
+	return topics, nil
+}
+
+// GetNSQDTopicProducers returns a []string containing the addresses of all
+// the given nsqd that produce the given topic.
+func (c *ClusterInfo) GetNSQDTopicProducers(topic string, nsqdHTTPAddrs []string) ([]string, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs PartialErr
+	addresses := make([]string, 0)
+	success := false
+
+	for _, addr := range nsqdHTTPAddrs {
+		wg.Add(1)
+		endpoint := fmt.Sprintf("http://%s/stats?format=json", addr)
+		c.logf("CLUSTERINFO: querying %s", endpoint)
+
+		go func(addr string, endpoint string) {
+			defer wg.Done()
+			var resp struct {
+				Topics []struct {
+					TopicName string `json:"topic_name"`
+				} `json:"topics"`
+			}
+			_, err := c.httpClient.GETV1(endpoint, &resp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				c.logf("ERROR: nsqd %s - %s", endpoint, err.Error())
+				errs = append(errs, fmt.Errorf("%s: %s", endpoint, err))
+				return
+			}
+			success = true
+			for _, t := range resp.Topics {
+				if t.TopicName == topic {
+					addresses = append(addresses, addr)
+					return
+				}
+			}
+		}(addr, endpoint)
+	}
+	wg.Wait()
+	if !success {
+		return nil, errs
+	}
+	return addresses, nil
+}
+
+// nsqdClientStats is the JSON shape of a single client entry under a
+// channel in nsqd's /stats?format=json response.
+type nsqdClientStats struct {
+	ClientID      string `json:"client_id"`
+	Name          string `json:"name"`
+	Hostname      string `json:"hostname"`
+	RemoteAddress string `json:"remote_address"`
+	Version       string `json:"version"`
+	UserAgent     string `json:"user_agent"`
+	ConnectTs     int64  `json:"connect_ts"`
+	InFlightCount int    `json:"in_flight_count"`
+	ReadyCount    int    `json:"ready_count"`
+	FinishCount   int64  `json:"finish_count"`
+	RequeueCount  int64  `json:"requeue_count"`
+	MessageCount  int64  `json:"message_count"`
+	SampleRate    int32  `json:"sample_rate"`
+	TLS           bool   `json:"tls"`
+	Deflate       bool   `json:"deflate"`
+	Snappy        bool   `json:"snappy"`
+}
+
+// GetNSQDStats returns aggregate topic and channel stats from the given
+// nsqd instances.
+//
+// If selectedTopic is empty, this returns stats for *all* topics/channels
+// and channelStatsMap is keyed by topic + ':' + channel.
+func (c *ClusterInfo) GetNSQDStats(nsqdHTTPAddrs []string, selectedTopic string) ([]*util.TopicStats, map[string]*util.ChannelStats, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs PartialErr
+
+	topicStatsList := make(util.TopicStatsList, 0)
+	channelStatsMap := make(map[string]*util.ChannelStats)
+	success := false
+
+	for _, addr := range nsqdHTTPAddrs {
+		wg.Add(1)
+		endpoint := fmt.Sprintf("http://%s/stats?format=json", addr)
+		c.logf("CLUSTERINFO: querying %s", endpoint)
+
+		go func(endpoint string, addr string) {
+			defer wg.Done()
+			var resp struct {
+				Topics []struct {
+					TopicName            string          `json:"topic_name"`
+					Depth                int64           `json:"depth"`
+					BackendDepth         int64           `json:"backend_depth"`
+					MessageCount         int64           `json:"message_count"`
+					Paused               bool            `json:"paused"`
+					E2eProcessingLatency json.RawMessage `json:"e2e_processing_latency"`
+					Channels             []struct {
+						ChannelName          string            `json:"channel_name"`
+						Depth                int64             `json:"depth"`
+						BackendDepth         int64             `json:"backend_depth"`
+						InFlightCount        int64             `json:"in_flight_count"`
+						DeferredCount        int64             `json:"deferred_count"`
+						MessageCount         int64             `json:"message_count"`
+						RequeueCount         int64             `json:"requeue_count"`
+						TimeoutCount         int64             `json:"timeout_count"`
+						Paused               bool              `json:"paused"`
+						E2eProcessingLatency json.RawMessage   `json:"e2e_processing_latency"`
+						Clients              []nsqdClientStats `json:"clients"`
+					} `json:"channels"`
+				} `json:"topics"`
+			}
+			_, err := c.httpClient.GETV1(endpoint, &resp)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				c.logf("ERROR: nsqd %s - %s", endpoint, err.Error())
+				errs = append(errs, fmt.Errorf("%s: %s", endpoint, err))
+				return
+			}
+			success = true
+
+			for _, t := range resp.Topics {
+				if selectedTopic != "" && t.TopicName != selectedTopic {
+					continue
+				}
+
+				topicStats := &util.TopicStats{
+					HostAddress:  addr,
+					TopicName:    t.TopicName,
+					Depth:        t.Depth,
+					BackendDepth: t.BackendDepth,
+					MemoryDepth:  t.Depth - t.BackendDepth,
+					MessageCount: t.MessageCount,
+					ChannelCount: len(t.Channels),
+					Paused:       t.Paused,
+
+					E2eProcessingLatency: e2eLatencyFromRawJSON(t.E2eProcessingLatency, t.TopicName, "", addr),
+				}
+				topicStatsList = append(topicStatsList, topicStats)
+
+				for _, ch := range t.Channels {
+					key := ch.ChannelName
+					if selectedTopic == "" {
+						key = fmt.Sprintf("%s:%s", t.TopicName, ch.ChannelName)
+					}
+
+					channelStats, ok := channelStatsMap[key]
+					if !ok {
+						channelStats = &util.ChannelStats{
+							HostAddress: addr,
+							TopicName:   t.TopicName,
+							ChannelName: ch.ChannelName,
+						}
+						channelStatsMap[key] = channelStats
+					}
+
+					hostChannelStats := &util.ChannelStats{
+						HostAddress:   addr,
+						TopicName:     t.TopicName,
+						ChannelName:   ch.ChannelName,
+						Depth:         ch.Depth,
+						BackendDepth:  ch.BackendDepth,
+						MemoryDepth:   ch.Depth - ch.BackendDepth,
+						Paused:        ch.Paused,
+						InFlightCount: ch.InFlightCount,
+						DeferredCount: ch.DeferredCount,
+						MessageCount:  ch.MessageCount,
+						RequeueCount:  ch.RequeueCount,
+						TimeoutCount:  ch.TimeoutCount,
+
+						E2eProcessingLatency: e2eLatencyFromRawJSON(ch.E2eProcessingLatency, t.TopicName, ch.ChannelName, addr),
+						// TODO: this is sort of wrong; clients should be de-duped
+						// client A that connects to NSQD-a and NSQD-b should only be counted once. right?
+						ClientCount: len(ch.Clients),
+					}
+					channelStats.Add(hostChannelStats)
+
+					for _, client := range ch.Clients {
+						connected := time.Unix(client.ConnectTs, 0)
+						connectedDuration := time.Now().Sub(connected).Seconds()
+
+						clientID := client.ClientID
+						if clientID == "" {
+							// TODO: deprecated, remove in 1.0
+							remoteAddressParts := strings.Split(client.RemoteAddress, ":")
+							port := remoteAddressParts[len(remoteAddressParts)-1]
+							if len(remoteAddressParts) < 2 {
+								port = "NA"
+							}
+							clientID = fmt.Sprintf("%s:%s", client.Name, port)
+						}
+
+						clientStats := &util.ClientStats{
+							HostAddress:       addr,
+							Version:           client.Version,
+							ClientID:          clientID,
+							Hostname:          client.Hostname,
+							UserAgent:         client.UserAgent,
+							ConnectedDuration: time.Duration(int64(connectedDuration)) * time.Second, // truncate to second
+							InFlightCount:     client.InFlightCount,
+							ReadyCount:        client.ReadyCount,
+							FinishCount:       client.FinishCount,
+							RequeueCount:      client.RequeueCount,
+							MessageCount:      client.MessageCount,
+							SampleRate:        client.SampleRate,
+							TLS:               client.TLS,
+							Deflate:           client.Deflate,
+							Snappy:            client.Snappy,
+						}
+						hostChannelStats.Clients = append(hostChannelStats.Clients, clientStats)
+						channelStats.Clients = append(channelStats.Clients, clientStats)
+					}
+					sort.Sort(util.ClientsByHost{Clients: hostChannelStats.Clients})
+					sort.Sort(util.ClientsByHost{Clients: channelStats.Clients})
+
+					topicStats.Channels = append(topicStats.Channels, hostChannelStats)
+				}
+			}
+		}(endpoint, addr)
+	}
+	wg.Wait()
+	sort.Sort(util.TopicStatsByHost{TopicStatsList: topicStatsList})
+	if !success {
+		return nil, nil, errs
+	}
+	return topicStatsList, channelStatsMap, nil
+}
+
+// e2eLatencyFromRawJSON parses a single nsqd host's e2e_processing_latency
+// stats block (captured as json.RawMessage so the static response shape
+// above doesn't need to know its internal layout) via simplejson, so it can
+// be merged with other hosts' summaries through util.E2eProcessingLatency.Merge.
+func e2eLatencyFromRawJSON(raw json.RawMessage, topicName string, channelName string, addr string) *util.E2eProcessingLatency {
+	if len(raw) == 0 {
+		return nil
+	}
+	data, err := simplejson.NewJson(raw)
+	if err != nil {
+		return nil
+	}
+	return util.E2eProcessingLatencyAggregateFromJson(data, topicName, channelName, addr)
+}
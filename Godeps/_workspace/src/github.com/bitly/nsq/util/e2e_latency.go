@@ -0,0 +1,216 @@
+package util
+
+import (
+	"math"
+	"sort"
+
+	"github.com/bitly/go-simplejson"
+)
+
+// DefaultE2eCompression is the t-digest compression parameter (delta) used
+// when none is specified: higher values retain more centroids (more
+// accuracy, more memory).
+const DefaultE2eCompression = 100.0
+
+// centroid is a single {mean, weight} point of a t-digest summary.
+type centroid struct {
+	Mean   float64
+	Weight float64
+}
+
+type byMean []centroid
+
+func (c byMean) Len() int           { return len(c) }
+func (c byMean) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byMean) Less(i, j int) bool { return c[i].Mean < c[j].Mean }
+
+// E2eProcessingLatency is a cluster-wide view of nsqd's end-to-end
+// processing latency stat (the time between a message being published and
+// being finished), built by merging the per-host t-digest summaries with
+// Merge.
+type E2eProcessingLatency struct {
+	Count       int64
+	Compression float64
+	Percentiles []map[string]float64
+
+	centroids []centroid
+}
+
+// NewE2eProcessingLatency returns an empty E2eProcessingLatency ready to
+// Merge per-host summaries into.
+func NewE2eProcessingLatency() *E2eProcessingLatency {
+	return &E2eProcessingLatency{Compression: DefaultE2eCompression}
+}
+
+// kscale is the t-digest scale function bounding how much weight a single
+// centroid may represent at cumulative-weight fraction q.
+func kscale(q float64, compression float64) float64 {
+	return (compression / (2 * math.Pi)) * math.Asin(2*q-1)
+}
+
+func totalWeight(centroids []centroid) float64 {
+	var w float64
+	for _, c := range centroids {
+		w += c.Weight
+	}
+	return w
+}
+
+func mergeSortedCentroids(a, b []centroid) []centroid {
+	merged := make([]centroid, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i].Mean <= b[j].Mean {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	merged = append(merged, b[j:]...)
+	return merged
+}
+
+// Merge folds other's centroids into e, compacting adjacent centroids
+// whenever their combined cumulative-weight span stays within the
+// t-digest scale-function bound, and recomputes e.Percentiles from the
+// result.
+func (e *E2eProcessingLatency) Merge(other *E2eProcessingLatency) {
+	if other == nil {
+		return
+	}
+
+	compression := e.Compression
+	if compression == 0 {
+		compression = DefaultE2eCompression
+	}
+
+	combined := mergeSortedCentroids(e.centroids, other.centroids)
+	e.Count += other.Count
+
+	total := totalWeight(combined)
+	if total == 0 {
+		e.Compression = compression
+		return
+	}
+
+	compacted := make([]centroid, 0, len(combined))
+	cur := combined[0]
+	var cumWeight float64
+
+	for _, c := range combined[1:] {
+		q0 := cumWeight / total
+		q1 := (cumWeight + cur.Weight + c.Weight) / total
+		if kscale(q1, compression)-kscale(q0, compression) <= 1 {
+			newWeight := cur.Weight + c.Weight
+			cur.Mean = (cur.Mean*cur.Weight + c.Mean*c.Weight) / newWeight
+			cur.Weight = newWeight
+		} else {
+			cumWeight += cur.Weight
+			compacted = append(compacted, cur)
+			cur = c
+		}
+	}
+	compacted = append(compacted, cur)
+
+	e.centroids = compacted
+	e.Compression = compression
+	e.Percentiles = computePercentiles(compacted, total)
+}
+
+// percentile scans centroids for the one straddling the target cumulative
+// weight fraction q and linearly interpolates between adjacent centroid
+// means.
+func percentile(centroids []centroid, total float64, q float64) float64 {
+	if len(centroids) == 0 || total == 0 {
+		return 0
+	}
+	target := q * total
+	var cumWeight float64
+	for i, c := range centroids {
+		next := cumWeight + c.Weight
+		if target <= next || i == len(centroids)-1 {
+			if i == len(centroids)-1 {
+				return c.Mean
+			}
+			// interpolate between this centroid and the next
+			frac := (target - cumWeight) / c.Weight
+			if frac < 0 {
+				frac = 0
+			}
+			return c.Mean + frac*(centroids[i+1].Mean-c.Mean)
+		}
+		cumWeight = next
+	}
+	return centroids[len(centroids)-1].Mean
+}
+
+func computePercentiles(centroids []centroid, total float64) []map[string]float64 {
+	quantiles := []float64{0.50, 0.95, 0.99}
+	percentiles := make([]map[string]float64, 0, len(quantiles))
+	for _, q := range quantiles {
+		percentiles = append(percentiles, map[string]float64{
+			"quantile": q,
+			"value":    percentile(centroids, total, q),
+		})
+	}
+	return percentiles
+}
+
+// E2eProcessingLatencyAggregateFromJson parses a single nsqd host's
+// e2e_processing_latency stats block (as returned under /stats?format=json)
+// into an E2eProcessingLatency, synthesizing a centroid per reported
+// percentile so it can be merged with other hosts' summaries via Merge.
+func E2eProcessingLatencyAggregateFromJson(data *simplejson.Json, topicName string, channelName string, addr string) *E2eProcessingLatency {
+	if data == nil {
+		return nil
+	}
+
+	count := data.Get("count").MustInt64()
+	e := NewE2eProcessingLatency()
+	e.Count = count
+	if count == 0 {
+		return e
+	}
+
+	percentilesArray, _ := data.Get("percentiles").Array()
+	centroids := make([]centroid, 0, len(percentilesArray))
+	for i := range percentilesArray {
+		p := data.Get("percentiles").GetIndex(i)
+		quantile := p.Get("quantile").MustFloat64()
+		value := p.Get("value").MustFloat64()
+		weight := quantile * float64(count)
+		if weight <= 0 {
+			weight = 1
+		}
+		centroids = append(centroids, centroid{Mean: value, Weight: weight})
+	}
+	sort.Sort(byMean(centroids))
+
+	e.centroids = centroids
+	e.Percentiles = computePercentiles(centroids, totalWeight(centroids))
+	return e
+}
+
+// AggregateChannel returns a new cluster-wide ChannelStats for channelName,
+// built by merging every per-host entry in t.Channels that matches it.
+func (t *TopicStats) AggregateChannel(channelName string) *ChannelStats {
+	agg := &ChannelStats{TopicName: t.TopicName, ChannelName: channelName}
+	for _, c := range t.Channels {
+		if c.ChannelName == channelName {
+			agg.Add(c)
+		}
+	}
+	return agg
+}
+
+// Aggregate finalizes c as a cluster-wide view by recomputing its merged
+// E2eProcessingLatency percentiles, and returns c for chaining.
+func (c *ChannelStats) Aggregate() *ChannelStats {
+	if c.E2eProcessingLatency != nil {
+		c.E2eProcessingLatency.Percentiles = computePercentiles(c.E2eProcessingLatency.centroids, totalWeight(c.E2eProcessingLatency.centroids))
+	}
+	return c
+}
@@ -0,0 +1,126 @@
+package util
+
+import "testing"
+
+func TestPercentile(t *testing.T) {
+	// three equally-weighted centroids spanning 10/20/30; total weight 3.
+	centroids := []centroid{
+		{Mean: 10, Weight: 1},
+		{Mean: 20, Weight: 1},
+		{Mean: 30, Weight: 1},
+	}
+	total := totalWeight(centroids)
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 10},
+		{1, 30},
+		{0.5, 25},
+	}
+	for _, tt := range tests {
+		got := percentile(centroids, total, tt.q)
+		if got != tt.want {
+			t.Errorf("percentile(q=%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestPercentileEmpty(t *testing.T) {
+	if got := percentile(nil, 0, 0.5); got != 0 {
+		t.Errorf("percentile on empty centroids = %v, want 0", got)
+	}
+}
+
+func TestMergeSumsCount(t *testing.T) {
+	a := NewE2eProcessingLatency()
+	a.Count = 10
+	a.centroids = []centroid{{Mean: 5, Weight: 10}}
+
+	b := NewE2eProcessingLatency()
+	b.Count = 20
+	b.centroids = []centroid{{Mean: 15, Weight: 20}}
+
+	a.Merge(b)
+
+	if a.Count != 30 {
+		t.Errorf("Count = %d, want 30", a.Count)
+	}
+	if w := totalWeight(a.centroids); w != 30 {
+		t.Errorf("total centroid weight = %v, want 30", w)
+	}
+}
+
+func TestMergeNilOtherIsNoOp(t *testing.T) {
+	a := NewE2eProcessingLatency()
+	a.Count = 10
+	a.centroids = []centroid{{Mean: 5, Weight: 10}}
+
+	a.Merge(nil)
+
+	if a.Count != 10 {
+		t.Errorf("Count = %d, want 10", a.Count)
+	}
+	if len(a.centroids) != 1 {
+		t.Errorf("centroids = %v, want unchanged", a.centroids)
+	}
+}
+
+func TestMergePopulatesPercentiles(t *testing.T) {
+	a := NewE2eProcessingLatency()
+	a.centroids = []centroid{{Mean: 10, Weight: 50}}
+	a.Count = 50
+
+	b := NewE2eProcessingLatency()
+	b.centroids = []centroid{{Mean: 20, Weight: 50}}
+	b.Count = 50
+
+	a.Merge(b)
+
+	if len(a.Percentiles) != 3 {
+		t.Fatalf("Percentiles has %d entries, want 3", len(a.Percentiles))
+	}
+	for _, p := range a.Percentiles {
+		if p["value"] < 10 || p["value"] > 20 {
+			t.Errorf("percentile %v value %v out of merged range [10,20]", p["quantile"], p["value"])
+		}
+	}
+}
+
+// TestMergeCompactsWithinScaleBound merges many equal single-weight
+// centroids and checks the result still satisfies the basic t-digest
+// invariants: total weight and count are preserved, and compaction never
+// produces more centroids than it started with.
+func TestMergeCompactsWithinScaleBound(t *testing.T) {
+	a := NewE2eProcessingLatency()
+	a.Compression = DefaultE2eCompression
+	for i := 0; i < 50; i++ {
+		a.centroids = append(a.centroids, centroid{Mean: float64(i), Weight: 1})
+	}
+	a.Count = 50
+
+	b := NewE2eProcessingLatency()
+	b.Compression = DefaultE2eCompression
+	for i := 50; i < 100; i++ {
+		b.centroids = append(b.centroids, centroid{Mean: float64(i), Weight: 1})
+	}
+	b.Count = 50
+
+	a.Merge(b)
+
+	if a.Count != 100 {
+		t.Fatalf("Count = %d, want 100", a.Count)
+	}
+	if got := totalWeight(a.centroids); got != 100 {
+		t.Fatalf("total centroid weight = %v, want 100", got)
+	}
+	if len(a.centroids) > 100 {
+		t.Fatalf("Merge produced %d centroids from 100 inputs, compaction should not grow the set", len(a.centroids))
+	}
+	for i := 1; i < len(a.centroids); i++ {
+		if a.centroids[i].Mean < a.centroids[i-1].Mean {
+			t.Fatalf("centroids not in ascending mean order at %d: %v before %v", i, a.centroids[i-1], a.centroids[i])
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package httpclient is a small HTTP client for talking to the v1 nsqd and
+// nsqlookupd HTTP APIs. It replaces the ad-hoc util.ApiRequest calls that
+// used to be scattered through the cluster-query code with a single place
+// to configure TLS, timeouts, retries, and content negotiation.
+package httpclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// AcceptV1 is the Accept header sent by NegotiateV1 to ask nsqd/nsqlookupd
+// for the v1 flat-JSON response format introduced in nsqd >= 0.2.29.
+const AcceptV1 = "application/vnd.nsq; version=1.0"
+
+// Err is returned for any non-2xx HTTP response, instead of the caller
+// having to re-parse a logged-and-discarded error.
+type Err struct {
+	Code int
+	Text string
+}
+
+func (e Err) Error() string {
+	return fmt.Sprintf("got response %d %q", e.Code, e.Text)
+}
+
+// legacyEnvelope is the pre-v1 response shape every endpoint used to return.
+type legacyEnvelope struct {
+	StatusCode int             `json:"status_code"`
+	StatusTxt  string          `json:"status_txt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Client issues content-negotiated requests against nsqd/nsqlookupd, with
+// configurable timeouts, TLS, and a small bounded retry loop.
+type Client struct {
+	httpClient *http.Client
+
+	// ConnectTimeout bounds dialing the remote host.
+	ConnectTimeout time.Duration
+	// RequestTimeout bounds the full round trip, including retries.
+	RequestTimeout time.Duration
+	// MaxRetries is how many additional attempts are made after the first
+	// failed one. 0 disables retries.
+	MaxRetries int
+	// RetryDelay is how long to wait between retries.
+	RetryDelay time.Duration
+}
+
+// NewClient returns a Client that negotiates tlsConfig on the connections it
+// makes (tlsConfig may be nil to disable TLS).
+func NewClient(tlsConfig *tls.Config) *Client {
+	c := &Client{
+		ConnectTimeout: 2 * time.Second,
+		RequestTimeout: 5 * time.Second,
+		MaxRetries:     2,
+		RetryDelay:     200 * time.Millisecond,
+	}
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, addr, c.ConnectTimeout)
+		},
+	}
+	c.httpClient = &http.Client{
+		Transport: transport,
+		Timeout:   c.RequestTimeout,
+	}
+	return c
+}
+
+// GETV1 issues a content-negotiated GET to endpoint and unmarshals the
+// response into v. It returns the HTTP status code alongside any error.
+func (c *Client) GETV1(endpoint string, v interface{}) (int, error) {
+	return c.NegotiateV1("GET", endpoint, nil, v)
+}
+
+// POSTV1 issues a content-negotiated POST (with an empty body) to endpoint
+// and unmarshals the response into v.
+func (c *Client) POSTV1(endpoint string, v interface{}) (int, error) {
+	return c.NegotiateV1("POST", endpoint, nil, v)
+}
+
+// NegotiateV1 issues method against endpoint with body, asking for the v1
+// response format via the Accept header. When the server answers with the
+// legacy {"status_code":200,"data":{...}} envelope, data is transparently
+// unwrapped before being unmarshaled into v; a v1 server's flat body is
+// unmarshaled directly. Non-2xx responses are returned as an Err rather
+// than logged and swallowed.
+func (c *Client) NegotiateV1(method string, endpoint string, body []byte, v interface{}) (int, error) {
+	var statusCode int
+	var respBody []byte
+
+	attempts := c.MaxRetries + 1
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.RetryDelay)
+		}
+
+		var bodyReader *bytes.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		} else {
+			bodyReader = bytes.NewReader(nil)
+		}
+
+		req, err := http.NewRequest(method, endpoint, bodyReader)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Accept", AcceptV1)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		respBody, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		statusCode = resp.StatusCode
+		lastErr = nil
+		break
+	}
+	if lastErr != nil {
+		return 0, lastErr
+	}
+
+	if statusCode < 200 || statusCode >= 300 {
+		return statusCode, Err{Code: statusCode, Text: string(respBody)}
+	}
+
+	if v == nil || len(respBody) == 0 {
+		return statusCode, nil
+	}
+
+	var envelope legacyEnvelope
+	if err := json.Unmarshal(respBody, &envelope); err == nil && envelope.Data != nil {
+		return statusCode, json.Unmarshal(envelope.Data, v)
+	}
+
+	return statusCode, json.Unmarshal(respBody, v)
+}
@@ -0,0 +1,160 @@
+package util
+
+import (
+	"time"
+
+	"github.com/bitly/nsq/util/semver"
+)
+
+// Producer describes an nsqd instance as reported by nsqlookupd's /nodes
+// endpoint.
+type Producer struct {
+	Hostname         string
+	BroadcastAddress string
+	TcpPort          int
+	HttpPort         int
+	Version          string
+	VersionObj       semver.Version
+	OutOfDate        bool
+	Topics           ProducerTopics
+	RemoteAddresses  []string
+}
+
+// ProducerTopic is one topic served by a Producer, along with whether it has
+// been tombstoned on that node.
+type ProducerTopic struct {
+	Topic      string
+	Tombstoned bool
+}
+
+// ProducerTopics sorts by topic name.
+type ProducerTopics []ProducerTopic
+
+func (t ProducerTopics) Len() int      { return len(t) }
+func (t ProducerTopics) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t ProducerTopics) Less(i, j int) bool {
+	return t[i].Topic < t[j].Topic
+}
+
+// ProducersByHost sorts []*Producer by hostname.
+type ProducersByHost struct {
+	Producers []*Producer
+}
+
+func (p ProducersByHost) Len() int { return len(p.Producers) }
+func (p ProducersByHost) Swap(i, j int) {
+	p.Producers[i], p.Producers[j] = p.Producers[j], p.Producers[i]
+}
+func (p ProducersByHost) Less(i, j int) bool {
+	return p.Producers[i].Hostname < p.Producers[j].Hostname
+}
+
+// ClientStats describes a single client connected to a channel on a single
+// nsqd instance.
+type ClientStats struct {
+	HostAddress       string
+	ClientID          string
+	Hostname          string
+	Version           string
+	UserAgent         string
+	ConnectedDuration time.Duration
+	InFlightCount     int
+	ReadyCount        int
+	FinishCount       int64
+	RequeueCount      int64
+	MessageCount      int64
+	SampleRate        int32
+	TLS               bool
+	Deflate           bool
+	Snappy            bool
+}
+
+// ClientsByHost sorts []*ClientStats by HostAddress.
+type ClientsByHost struct {
+	Clients []*ClientStats
+}
+
+func (c ClientsByHost) Len() int      { return len(c.Clients) }
+func (c ClientsByHost) Swap(i, j int) { c.Clients[i], c.Clients[j] = c.Clients[j], c.Clients[i] }
+func (c ClientsByHost) Less(i, j int) bool {
+	return c.Clients[i].HostAddress < c.Clients[j].HostAddress
+}
+
+// ChannelStats describes a single channel, either as reported by one nsqd
+// (HostAddress set) or aggregated cluster-wide via Add (HostAddress empty).
+type ChannelStats struct {
+	HostAddress   string
+	TopicName     string
+	ChannelName   string
+	Depth         int64
+	BackendDepth  int64
+	MemoryDepth   int64
+	InFlightCount int64
+	DeferredCount int64
+	MessageCount  int64
+	RequeueCount  int64
+	TimeoutCount  int64
+	ClientCount   int
+	Clients       []*ClientStats
+	Paused        bool
+
+	E2eProcessingLatency *E2eProcessingLatency
+}
+
+// Add folds one host's view of a channel into the cluster-wide aggregate c.
+func (c *ChannelStats) Add(a *ChannelStats) {
+	c.Depth += a.Depth
+	c.BackendDepth += a.BackendDepth
+	c.MemoryDepth += a.MemoryDepth
+	c.InFlightCount += a.InFlightCount
+	c.DeferredCount += a.DeferredCount
+	c.MessageCount += a.MessageCount
+	c.RequeueCount += a.RequeueCount
+	c.TimeoutCount += a.TimeoutCount
+	c.ClientCount += a.ClientCount
+	c.Paused = c.Paused || a.Paused
+
+	if a.E2eProcessingLatency != nil {
+		if c.E2eProcessingLatency == nil {
+			c.E2eProcessingLatency = NewE2eProcessingLatency()
+		}
+		c.E2eProcessingLatency.Merge(a.E2eProcessingLatency)
+	}
+}
+
+// TopicStats describes a single topic, either as reported by one nsqd
+// (HostAddress set) or aggregated cluster-wide.
+type TopicStats struct {
+	HostAddress  string
+	TopicName    string
+	Depth        int64
+	BackendDepth int64
+	MemoryDepth  int64
+	MessageCount int64
+	ChannelCount int
+	Paused       bool
+
+	E2eProcessingLatency *E2eProcessingLatency
+
+	Channels []*ChannelStats
+}
+
+// TopicStatsList is a collection of TopicStats, sorted by TopicStatsByHost.
+type TopicStatsList []*TopicStats
+
+// TopicStatsByHost sorts a TopicStatsList by HostAddress, then TopicName.
+type TopicStatsByHost struct {
+	TopicStatsList
+}
+
+func (t TopicStatsByHost) Len() int { return len(t.TopicStatsList) }
+func (t TopicStatsByHost) Swap(i, j int) {
+	t.TopicStatsList[i], t.TopicStatsList[j] = t.TopicStatsList[j], t.TopicStatsList[i]
+}
+func (t TopicStatsByHost) Less(i, j int) bool {
+	a, b := t.TopicStatsList[i], t.TopicStatsList[j]
+	if a.HostAddress == b.HostAddress {
+		return a.TopicName < b.TopicName
+	}
+	return a.HostAddress < b.HostAddress
+}
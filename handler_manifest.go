@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// defaultHandlerTimeout bounds how long a handler may run before its
+// process group is killed, for events with no handlers.toml entry (or no
+// timeout set in their entry)
+const defaultHandlerTimeout = 30 * time.Second
+
+// defaultHandlerBackoff is the REQ delay used when a handler exits
+// non-zero or times out and its handlers.toml entry doesn't set backoff
+const defaultHandlerBackoff = 1 * time.Second
+
+// handlerConfig holds the per-handler overrides read from handlers.toml
+type handlerConfig struct {
+	Timeout string `toml:"timeout"`
+	Backoff string `toml:"backoff"`
+}
+
+// handlerManifest maps event name to its handlerConfig, as read from
+// handlers.toml in handlersDir
+type handlerManifest struct {
+	Handlers map[string]handlerConfig `toml:"handlers"`
+}
+
+// loadHandlerManifest reads handlers.toml from handlersDir. A missing file
+// is not an error - every event just falls back to the defaults.
+func loadHandlerManifest(handlersDir string) (*handlerManifest, error) {
+	m := &handlerManifest{Handlers: map[string]handlerConfig{}}
+
+	manifestPath := filepath.Join(handlersDir, "handlers.toml")
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		return m, nil
+	}
+
+	if _, err := toml.DecodeFile(manifestPath, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// timeout returns the configured timeout for event, or defaultHandlerTimeout
+func (m *handlerManifest) timeout(event string) time.Duration {
+	if hc, ok := m.Handlers[event]; ok && hc.Timeout != "" {
+		if d, err := time.ParseDuration(hc.Timeout); err == nil {
+			return d
+		}
+	}
+	return defaultHandlerTimeout
+}
+
+// backoff returns the configured REQ delay for event, or defaultHandlerBackoff
+func (m *handlerManifest) backoff(event string) time.Duration {
+	if hc, ok := m.Handlers[event]; ok && hc.Backoff != "" {
+		if d, err := time.ParseDuration(hc.Backoff); err == nil {
+			return d
+		}
+	}
+	return defaultHandlerBackoff
+}
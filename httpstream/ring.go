@@ -0,0 +1,127 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// entry is one message retained by a ring for replay to newly-connecting
+// clients.
+type entry struct {
+	Timestamp int64  `json:"timestamp"`
+	Body      []byte `json:"body"`
+}
+
+// ring is a fixed-size, on-disk-backed circular buffer of the most recent
+// messages seen for a topic/channel, used to serve `?since=` and
+// `?replay=` backfill before a subscriber switches to live tail.
+type ring struct {
+	mu      sync.Mutex
+	entries []entry
+	size    int
+	next    int
+	filled  bool
+	path    string
+}
+
+// newRing returns a ring of the given size, loading any previously
+// persisted entries from path (if non-empty and present on disk).
+func newRing(size int, path string) *ring {
+	r := &ring{
+		entries: make([]entry, size),
+		size:    size,
+		path:    path,
+	}
+	if path != "" {
+		r.load()
+	}
+	return r
+}
+
+func (r *ring) load() {
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return
+	}
+	var saved []entry
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return
+	}
+	for _, e := range saved {
+		r.addLocked(e)
+	}
+}
+
+// persist rewrites the ring's on-disk snapshot. It's called synchronously
+// after each add, which is fine at the scale a replay ring is meant for
+// (tens to low thousands of entries); it is not meant to survive
+// high-throughput topics untouched.
+func (r *ring) persist() {
+	if r.path == "" {
+		return
+	}
+	data, err := json.Marshal(r.ordered())
+	if err != nil {
+		return
+	}
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, r.path)
+}
+
+func (r *ring) add(e entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addLocked(e)
+	r.persist()
+}
+
+func (r *ring) addLocked(e entry) {
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % r.size
+	if r.next == 0 {
+		r.filled = true
+	}
+}
+
+// ordered returns the ring's entries in chronological order.
+func (r *ring) ordered() []entry {
+	if !r.filled {
+		out := make([]entry, r.next)
+		copy(out, r.entries[:r.next])
+		return out
+	}
+	out := make([]entry, r.size)
+	copy(out, r.entries[r.next:])
+	copy(out[r.size-r.next:], r.entries[:r.next])
+	return out
+}
+
+// lastN returns up to the n most recent entries, oldest first.
+func (r *ring) lastN(n int) []entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := r.ordered()
+	if n <= 0 || n >= len(all) {
+		return all
+	}
+	return all[len(all)-n:]
+}
+
+// since returns every retained entry with Timestamp >= unixNs.
+func (r *ring) since(unixNs int64) []entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := r.ordered()
+	out := make([]entry, 0, len(all))
+	for _, e := range all {
+		if e.Timestamp >= unixNs {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,295 @@
+// Package httpstream bridges NSQ to browsers and other lightweight HTTP
+// clients that can't speak the TCP protocol: it serves GET /sub?topic=X&channel=Y
+// upgraded to a WebSocket, internally consuming the requested topic/channel
+// and forwarding each message on as a frame.
+package httpstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bitly/go-nsq"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long a single frame write may take before the
+	// connection is considered dead.
+	writeWait = 10 * time.Second
+	// pongWait is how long to wait for a pong before giving up on the
+	// connection.
+	pongWait = 60 * time.Second
+	// pingPeriod must be less than pongWait; it's how often a ping is sent.
+	pingPeriod = 54 * time.Second
+	// sendBufferSize bounds how many unsent frames are queued per
+	// connection before new ones are dropped.
+	sendBufferSize = 256
+)
+
+// ErrBufferFull is recorded (and the frame dropped) when a connection's
+// send buffer is still full by the time a new message arrives.
+var ErrBufferFull = errors.New("httpstream: send buffer full")
+
+// Frame is the JSON representation of a message pushed to a subscriber.
+// Body is base64-encoded by encoding/json's default []byte handling.
+type Frame struct {
+	Id        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Attempts  uint16 `json:"attempts"`
+	Body      []byte `json:"body"`
+}
+
+// Server serves the /sub WebSocket endpoint described in the package doc.
+type Server struct {
+	NsqdTCPAddrs     []string
+	LookupdHTTPAddrs []string
+
+	// RingSize bounds how many recent messages per topic/channel are kept
+	// for ?since=/?replay= backfill. Defaults to 1000.
+	RingSize int
+	// RingDir, if non-empty, persists each topic/channel's ring to a file
+	// in this directory so backfill survives a restart.
+	RingDir string
+
+	upgrader websocket.Upgrader
+
+	ringsMu sync.Mutex
+	rings   map[string]*ring
+}
+
+// NewServer returns a Server that dials nsqdTCPAddrs directly, or discovers
+// producers via lookupdHTTPAddrs (exactly one of the two should be set, as
+// with nsq_event_router).
+func NewServer(nsqdTCPAddrs []string, lookupdHTTPAddrs []string) *Server {
+	return &Server{
+		NsqdTCPAddrs:     nsqdTCPAddrs,
+		LookupdHTTPAddrs: lookupdHTTPAddrs,
+		RingSize:         1000,
+		rings:            make(map[string]*ring),
+	}
+}
+
+// ringFor returns (creating if necessary) the replay ring for topic/channel.
+// ServeHTTP runs concurrently per incoming subscriber, so access to rings
+// is serialized with ringsMu.
+func (s *Server) ringFor(topic, channel string) *ring {
+	key := topic + ":" + channel
+
+	s.ringsMu.Lock()
+	defer s.ringsMu.Unlock()
+
+	if r, ok := s.rings[key]; ok {
+		return r
+	}
+	var path string
+	if s.RingDir != "" {
+		path = filepath.Join(s.RingDir, key+".ring.json")
+	}
+	r := newRing(s.RingSize, path)
+	s.rings[key] = r
+	return r
+}
+
+// ServeHTTP implements GET /sub?topic=X&channel=Y[&format=binary][&since=<unix_ns>][&replay=N].
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/sub" || req.Method != "GET" {
+		http.NotFound(w, req)
+		return
+	}
+
+	topic := req.URL.Query().Get("topic")
+	if topic == "" {
+		http.Error(w, "topic is required", http.StatusBadRequest)
+		return
+	}
+
+	channel := req.URL.Query().Get("channel")
+	if channel == "" {
+		channel = fmt.Sprintf("httpstream%06d#ephemeral", rand.Int()%999999)
+	}
+
+	binary := req.URL.Query().Get("format") == "binary"
+
+	var since int64
+	if v := req.URL.Query().Get("since"); v != "" {
+		since, _ = strconv.ParseInt(v, 10, 64)
+	}
+	var replay int
+	if v := req.URL.Query().Get("replay"); v != "" {
+		replay, _ = strconv.Atoi(v)
+	}
+
+	conn, err := s.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Printf("httpstream: upgrade failed - %s", err)
+		return
+	}
+
+	sub := &subscriber{
+		conn:     conn,
+		sendChan: make(chan []byte, sendBufferSize),
+		binary:   binary,
+		topic:    topic,
+		channel:  channel,
+		exitChan: make(chan struct{}),
+	}
+
+	r := s.ringFor(topic, channel)
+	var backlog []entry
+	switch {
+	case replay > 0:
+		backlog = r.lastN(replay)
+	case since > 0:
+		backlog = r.since(since)
+	}
+	for _, e := range backlog {
+		sub.enqueue(&nsq.Message{Timestamp: e.Timestamp, Body: e.Body})
+	}
+
+	reader, err := nsq.NewReader(topic, channel)
+	if err != nil {
+		log.Printf("httpstream: failed to create reader for %s/%s - %s", topic, channel, err)
+		conn.Close()
+		return
+	}
+	reader.AddHandler(&subscriberHandler{sub: sub, ring: r})
+
+	if len(s.NsqdTCPAddrs) > 0 {
+		for _, addr := range s.NsqdTCPAddrs {
+			if err := reader.ConnectToNSQ(addr); err != nil {
+				log.Printf("httpstream: failed to connect to nsqd %s - %s", addr, err)
+			}
+		}
+	} else {
+		for _, addr := range s.LookupdHTTPAddrs {
+			if err := reader.ConnectToLookupd(addr); err != nil {
+				log.Printf("httpstream: failed to connect to lookupd %s - %s", addr, err)
+			}
+		}
+	}
+
+	sub.reader = reader
+
+	go sub.writeLoop()
+	sub.readLoop()
+}
+
+// subscriber owns one upgraded WebSocket connection and the bounded,
+// drop-when-full queue of outgoing frames for it.
+type subscriber struct {
+	conn     *websocket.Conn
+	sendChan chan []byte
+	binary   bool
+	topic    string
+	channel  string
+	exitChan chan struct{}
+	reader   *nsq.Reader
+}
+
+// enqueue frames and non-blockingly queues msg for delivery, dropping it
+// (with ErrBufferFull) if the connection is backed up.
+func (s *subscriber) enqueue(msg *nsq.Message) {
+	var frame []byte
+	var err error
+	if s.binary {
+		frame, err = msg.EncodeBytes()
+	} else {
+		frame, err = json.Marshal(Frame{
+			Id:        string(msg.Id[:]),
+			Timestamp: msg.Timestamp,
+			Attempts:  msg.Attempts,
+			Body:      msg.Body,
+		})
+	}
+	if err != nil {
+		log.Printf("httpstream: failed to encode frame for %s/%s - %s", s.topic, s.channel, err)
+		return
+	}
+
+	select {
+	case s.sendChan <- frame:
+	default:
+		log.Printf("httpstream: %s/%s - %s", s.topic, s.channel, ErrBufferFull)
+	}
+}
+
+func (s *subscriber) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		s.conn.Close()
+	}()
+
+	messageType := websocket.TextMessage
+	if s.binary {
+		messageType = websocket.BinaryMessage
+	}
+
+	for {
+		select {
+		case frame, ok := <-s.sendChan:
+			s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				s.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := s.conn.WriteMessage(messageType, frame); err != nil {
+				return
+			}
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-s.exitChan:
+			return
+		}
+	}
+}
+
+// readLoop pumps (and discards) incoming frames/control messages so pongs
+// get processed, until the client disconnects - at which point the backing
+// NSQ reader is stopped.
+func (s *subscriber) readLoop() {
+	defer func() {
+		close(s.exitChan)
+		if s.reader != nil {
+			s.reader.Stop()
+		}
+	}()
+
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		s.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		if _, _, err := s.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// subscriberHandler implements nsq.Reader's message handler interface,
+// recording each delivered message into the replay ring and forwarding it
+// to the subscriber, then immediately acking it - this endpoint is a
+// fire-and-forget bridge, not a durable consumer.
+type subscriberHandler struct {
+	sub  *subscriber
+	ring *ring
+}
+
+func (h *subscriberHandler) HandleMessage(m *nsq.Message) error {
+	h.ring.add(entry{Timestamp: m.Timestamp, Body: m.Body})
+	h.sub.enqueue(m)
+	return nil
+}
@@ -0,0 +1,342 @@
+// Package journal implements a small segmented, append-only write-ahead log
+// used by nsq_trigger to durably record events before (or instead of)
+// posting them to nsqd, and to replay them later.
+//
+// Each topic gets its own sequence space. Records are appended to a segment
+// file as a 4-byte big-endian length prefix followed by the bytes produced
+// by nsq.Message.Write, so a record round-trips through nsq.DecodeMessage
+// once the length prefix has been stripped. A companion index file maps
+// sequence number to segment/offset so Replay and Tail don't have to scan
+// every segment from the start.
+package journal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bitly/go-nsq"
+)
+
+// DefaultSegmentBytes is the segment size used when none is specified.
+const DefaultSegmentBytes = 16 * 1024 * 1024
+
+// indexEntrySize is the on-disk size, in bytes, of a single index entry:
+// sequence (8) + segment id (4) + offset within segment (4).
+const indexEntrySize = 16
+
+// Record is a single journaled event as returned by ReadFrom and Tail.
+type Record struct {
+	Seq       uint64
+	Timestamp int64
+	Body      []byte
+}
+
+// topic tracks the mutable, per-topic append state: the currently open
+// segment file and its companion index file.
+type topic struct {
+	name string
+
+	nextSeq   uint64
+	segmentID uint32
+
+	segFile *os.File
+	segSize int64
+
+	idxFile *os.File
+}
+
+// Journal is a segmented WAL rooted at a directory, shared across topics.
+type Journal struct {
+	dir          string
+	segmentBytes int64
+
+	mu     sync.Mutex
+	topics map[string]*topic
+}
+
+// Open opens (creating if necessary) a journal rooted at dir. segmentBytes
+// bounds the size of each segment file before a new one is started; if 0,
+// DefaultSegmentBytes is used.
+func Open(dir string, segmentBytes int64) (*Journal, error) {
+	if segmentBytes <= 0 {
+		segmentBytes = DefaultSegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Journal{
+		dir:          dir,
+		segmentBytes: segmentBytes,
+		topics:       make(map[string]*topic),
+	}, nil
+}
+
+// Close flushes and closes every open segment/index file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var firstErr error
+	for _, t := range j.topics {
+		if err := t.segFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := t.idxFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (j *Journal) segmentPath(topicName string, segmentID uint32) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%s.%06d.seg", topicName, segmentID))
+}
+
+func (j *Journal) indexPath(topicName string) string {
+	return filepath.Join(j.dir, topicName+".idx")
+}
+
+// openTopic loads (or initializes) the append state for topicName, resuming
+// from the last index entry on disk if one exists.
+func (j *Journal) openTopic(topicName string) (*topic, error) {
+	if t, ok := j.topics[topicName]; ok {
+		return t, nil
+	}
+
+	idxFile, err := os.OpenFile(j.indexPath(topicName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &topic{name: topicName, idxFile: idxFile}
+
+	fi, err := idxFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() >= indexEntrySize {
+		last := make([]byte, indexEntrySize)
+		if _, err := idxFile.ReadAt(last, fi.Size()-indexEntrySize); err != nil {
+			return nil, err
+		}
+		seq, segmentID, _ := decodeIndexEntry(last)
+		t.nextSeq = seq + 1
+		t.segmentID = segmentID
+	}
+
+	segFile, err := os.OpenFile(j.segmentPath(topicName, t.segmentID), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	segFi, err := segFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	t.segFile = segFile
+	t.segSize = segFi.Size()
+
+	j.topics[topicName] = t
+	return t, nil
+}
+
+func encodeIndexEntry(seq uint64, segmentID uint32, offset uint32) []byte {
+	buf := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint64(buf[0:8], seq)
+	binary.BigEndian.PutUint32(buf[8:12], segmentID)
+	binary.BigEndian.PutUint32(buf[12:16], offset)
+	return buf
+}
+
+func decodeIndexEntry(buf []byte) (seq uint64, segmentID uint32, offset uint32) {
+	seq = binary.BigEndian.Uint64(buf[0:8])
+	segmentID = binary.BigEndian.Uint32(buf[8:12])
+	offset = binary.BigEndian.Uint32(buf[12:16])
+	return
+}
+
+// Append writes body to the journal for topicName, returning its assigned
+// sequence number. The sequence is encoded into the low 8 bytes of the
+// journaled message's Id so the record can still be decoded as a standalone
+// nsq.Message by Replay/Tail consumers.
+func (j *Journal) Append(topicName string, body []byte) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	t, err := j.openTopic(topicName)
+	if err != nil {
+		return 0, err
+	}
+
+	seq := t.nextSeq
+
+	var id nsq.MessageID
+	binary.BigEndian.PutUint64(id[8:], seq)
+	msg := nsq.NewMessage(id, body)
+
+	msgBytes, err := msg.EncodeBytes()
+	if err != nil {
+		return 0, err
+	}
+
+	if t.segSize > 0 && t.segSize+int64(len(msgBytes))+4 > j.segmentBytes {
+		if err := t.segFile.Close(); err != nil {
+			return 0, err
+		}
+		t.segmentID++
+		t.segFile, err = os.OpenFile(j.segmentPath(topicName, t.segmentID), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return 0, err
+		}
+		t.segSize = 0
+	}
+
+	offset := t.segSize
+
+	lenPrefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenPrefix, uint32(len(msgBytes)))
+	if _, err := t.segFile.Write(lenPrefix); err != nil {
+		return 0, err
+	}
+	if _, err := t.segFile.Write(msgBytes); err != nil {
+		return 0, err
+	}
+	t.segSize += int64(len(lenPrefix) + len(msgBytes))
+
+	if _, err := t.idxFile.Write(encodeIndexEntry(seq, t.segmentID, uint32(offset))); err != nil {
+		return 0, err
+	}
+
+	t.nextSeq++
+	return seq, nil
+}
+
+// ReadFrom returns every record for topicName with sequence >= from, in
+// ascending sequence order.
+func (j *Journal) ReadFrom(topicName string, from uint64) ([]*Record, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	idxFile, err := os.Open(j.indexPath(topicName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer idxFile.Close()
+
+	entries, err := readIndexEntries(idxFile)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*Record, 0, len(entries))
+	segFiles := make(map[uint32]*os.File)
+	defer func() {
+		for _, f := range segFiles {
+			f.Close()
+		}
+	}()
+
+	for _, e := range entries {
+		if e.seq < from {
+			continue
+		}
+		f, ok := segFiles[e.segmentID]
+		if !ok {
+			f, err = os.Open(j.segmentPath(topicName, e.segmentID))
+			if err != nil {
+				return nil, err
+			}
+			segFiles[e.segmentID] = f
+		}
+		rec, err := readRecordAt(f, int64(e.offset), e.seq)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+type indexEntry struct {
+	seq       uint64
+	segmentID uint32
+	offset    uint32
+}
+
+func readIndexEntries(f *os.File) ([]indexEntry, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, fi.Size())
+	if _, err := f.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	n := len(buf) / indexEntrySize
+	entries := make([]indexEntry, n)
+	for i := 0; i < n; i++ {
+		seq, segmentID, offset := decodeIndexEntry(buf[i*indexEntrySize : (i+1)*indexEntrySize])
+		entries[i] = indexEntry{seq: seq, segmentID: segmentID, offset: offset}
+	}
+	return entries, nil
+}
+
+func readRecordAt(f *os.File, offset int64, seq uint64) (*Record, error) {
+	lenPrefix := make([]byte, 4)
+	if _, err := f.ReadAt(lenPrefix, offset); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(lenPrefix)
+	msgBytes := make([]byte, length)
+	if _, err := f.ReadAt(msgBytes, offset+4); err != nil {
+		return nil, err
+	}
+	msg, err := nsq.DecodeMessage(msgBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Seq: seq, Timestamp: msg.Timestamp, Body: msg.Body}, nil
+}
+
+// Tail streams records for topicName with sequence >= from, polling for new
+// writes every pollInterval until stopChan is closed. It is used to drive
+// `nsq_trigger tail --follow`.
+func (j *Journal) Tail(topicName string, from uint64, pollInterval time.Duration, stopChan <-chan struct{}) (<-chan *Record, <-chan error) {
+	recordChan := make(chan *Record)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(recordChan)
+		next := from
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			records, err := j.ReadFrom(topicName, next)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			for _, rec := range records {
+				select {
+				case recordChan <- rec:
+					next = rec.Seq + 1
+				case <-stopChan:
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+
+	return recordChan, errChan
+}
@@ -0,0 +1,183 @@
+package journal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestJournal returns a Journal rooted at a fresh temp directory that is
+// removed when the test completes.
+func openTestJournal(t *testing.T, segmentBytes int64) *Journal {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "journal_test")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	j, err := Open(dir, segmentBytes)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+func TestAppendReadFrom(t *testing.T) {
+	j := openTestJournal(t, 0)
+
+	bodies := [][]byte{[]byte("one"), []byte("two"), []byte("three")}
+	var seqs []uint64
+	for _, b := range bodies {
+		seq, err := j.Append("topic-a", b)
+		if err != nil {
+			t.Fatalf("Append: %s", err)
+		}
+		seqs = append(seqs, seq)
+	}
+	for i, seq := range seqs {
+		if seq != uint64(i) {
+			t.Fatalf("Append returned seq %d, expected %d", seq, i)
+		}
+	}
+
+	records, err := j.ReadFrom("topic-a", 0)
+	if err != nil {
+		t.Fatalf("ReadFrom: %s", err)
+	}
+	if len(records) != len(bodies) {
+		t.Fatalf("ReadFrom returned %d records, expected %d", len(records), len(bodies))
+	}
+	for i, rec := range records {
+		if rec.Seq != uint64(i) {
+			t.Errorf("record %d: Seq = %d, expected %d", i, rec.Seq, i)
+		}
+		if !bytes.Equal(rec.Body, bodies[i]) {
+			t.Errorf("record %d: Body = %q, expected %q", i, rec.Body, bodies[i])
+		}
+	}
+}
+
+func TestReadFromOffset(t *testing.T) {
+	j := openTestJournal(t, 0)
+
+	for _, b := range [][]byte{[]byte("one"), []byte("two"), []byte("three")} {
+		if _, err := j.Append("topic-a", b); err != nil {
+			t.Fatalf("Append: %s", err)
+		}
+	}
+
+	records, err := j.ReadFrom("topic-a", 1)
+	if err != nil {
+		t.Fatalf("ReadFrom: %s", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("ReadFrom(from=1) returned %d records, expected 2", len(records))
+	}
+	if records[0].Seq != 1 || records[1].Seq != 2 {
+		t.Fatalf("ReadFrom(from=1) returned seqs %d,%d, expected 1,2", records[0].Seq, records[1].Seq)
+	}
+}
+
+func TestReadFromUnknownTopic(t *testing.T) {
+	j := openTestJournal(t, 0)
+
+	records, err := j.ReadFrom("no-such-topic", 0)
+	if err != nil {
+		t.Fatalf("ReadFrom: %s", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("ReadFrom on unknown topic returned %d records, expected 0", len(records))
+	}
+}
+
+// TestAppendAcrossSegmentBoundary forces a tiny segmentBytes so a handful of
+// records span several segment files, then verifies ReadFrom still returns
+// every record in order - i.e. the per-segment index entries correctly
+// resolve across the segment:offset boundary.
+func TestAppendAcrossSegmentBoundary(t *testing.T) {
+	// Small enough that every record rolls into its own new segment, but big
+	// enough to hold one record's length-prefix + encoded bytes.
+	j := openTestJournal(t, 64)
+
+	const n = 20
+	bodies := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		bodies[i] = []byte{byte(i)}
+		if _, err := j.Append("topic-a", bodies[i]); err != nil {
+			t.Fatalf("Append %d: %s", i, err)
+		}
+	}
+
+	records, err := j.ReadFrom("topic-a", 0)
+	if err != nil {
+		t.Fatalf("ReadFrom: %s", err)
+	}
+	if len(records) != n {
+		t.Fatalf("ReadFrom returned %d records, expected %d", len(records), n)
+	}
+	for i, rec := range records {
+		if rec.Seq != uint64(i) {
+			t.Fatalf("record %d: Seq = %d, expected %d", i, rec.Seq, i)
+		}
+		if !bytes.Equal(rec.Body, bodies[i]) {
+			t.Fatalf("record %d: Body = %v, expected %v", i, rec.Body, bodies[i])
+		}
+	}
+
+	segments, err := filepath.Glob(filepath.Join(j.dir, "topic-a.*.seg"))
+	if err != nil {
+		t.Fatalf("glob segments: %s", err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected records to span multiple segments, found %d segment file(s)", len(segments))
+	}
+}
+
+// TestReopenResumesSequence verifies that closing and reopening a Journal
+// picks up nextSeq/segmentID from the on-disk index rather than restarting
+// from zero.
+func TestReopenResumesSequence(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal_test")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	j, err := Open(dir, 64)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := j.Append("topic-a", []byte{byte(i)}); err != nil {
+			t.Fatalf("Append: %s", err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	j2, err := Open(dir, 64)
+	if err != nil {
+		t.Fatalf("reopen: %s", err)
+	}
+	defer j2.Close()
+
+	seq, err := j2.Append("topic-a", []byte("next"))
+	if err != nil {
+		t.Fatalf("Append after reopen: %s", err)
+	}
+	if seq != 5 {
+		t.Fatalf("Append after reopen returned seq %d, expected 5", seq)
+	}
+
+	records, err := j2.ReadFrom("topic-a", 0)
+	if err != nil {
+		t.Fatalf("ReadFrom: %s", err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("ReadFrom after reopen returned %d records, expected 6", len(records))
+	}
+}
@@ -4,6 +4,9 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
   "regexp"
@@ -48,17 +51,22 @@ type EventRouter struct {
 	totalMessages int
 	messagesShown int
 	handlersDir   string
+	manifest      *handlerManifest
 }
 
-
+// handlerMessage is the JSON payload written to a handler's stdin,
+// replacing the old argv-splitting of the raw message body.
+type handlerMessage struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Attempts  uint16 `json:"attempts"`
+	Body      string `json:"body"`
+}
 
 func (th *EventRouter) HandleMessage(m *nsq.Message) error {
 	th.messagesShown++
 
-	msgParts := strings.Split(string(m.Body), " ")
-	eventName := msgParts[0]
-	handlerArguments := strings.Join(msgParts[1:], " ")
-
+	eventName := strings.SplitN(string(m.Body), " ", 2)[0]
 	handlerPath := filepath.Join(th.handlersDir, eventName)
 
 	if _, err := os.Stat(handlerPath); os.IsNotExist(err) {
@@ -66,22 +74,51 @@ func (th *EventRouter) HandleMessage(m *nsq.Message) error {
 		return nil
 	}
 
-	cmd := exec.Command(handlerPath, handlerArguments)
+	payload, err := json.Marshal(handlerMessage{
+		ID:        string(m.Id[:]),
+		Timestamp: m.Timestamp,
+		Attempts:  m.Attempts,
+		Body:      string(m.Body),
+	})
+	if err != nil {
+		log.Printf("[%s] failed to encode message: %s", eventName, err.Error())
+		return nil
+	}
+
+	timeout := th.manifest.timeout(eventName)
+	ctx, cancel := context.WithTimeout(m.Context(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, handlerPath)
 	cmd.Dir = th.handlersDir
+	// Setpgid puts the handler in its own process group so a timeout can
+	// kill it and anything it spawned, not just the direct child.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdin = bytes.NewReader(payload)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
 	log.Printf("Triggering event %s", eventName)
 
-	eventOutput, err := cmd.Output()
+	runErr := cmd.Run()
 
-  outputLines := strings.Split(string(eventOutput), "\n")
-  for i := range outputLines {
-    if outputLines[i] != "" {
-      log.Printf("[%s] %s", eventName, outputLines[i])
-    }
-  }
+	logHandlerOutput(eventName, "stdout", stdout.String())
+	logHandlerOutput(eventName, "stderr", stderr.String())
 
-	if err != nil {
-		log.Printf("[%s] failed with error: %s", eventName, err.Error())
+	if ctx.Err() == context.DeadlineExceeded {
+		if cmd.Process != nil {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		log.Printf("event=%q msg=\"handler timed out\" timeout=%q", eventName, timeout.String())
+		m.Requeue(int(th.manifest.backoff(eventName) / time.Millisecond))
+		return nil
+	}
+
+	if runErr != nil {
+		log.Printf("event=%q msg=\"handler exited with error\" error=%q", eventName, runErr.Error())
+		m.Requeue(int(th.manifest.backoff(eventName) / time.Millisecond))
 		return nil
 	}
 
@@ -92,6 +129,16 @@ func (th *EventRouter) HandleMessage(m *nsq.Message) error {
 	return nil
 }
 
+// logHandlerOutput streams a handler's captured stdout/stderr to the
+// logger line by line, tagged with the event name and source stream.
+func logHandlerOutput(eventName, stream, output string) {
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			log.Printf("event=%q stream=%q %s", eventName, stream, line)
+		}
+	}
+}
+
 var (
   logDatetimePattern = regexp.MustCompile("^(\\S*\\s){2}")
   queueAddressPattern = regexp.MustCompile("^\\[(.*)(event_router)(\\d+)(#ephemeral)\\]\\s")
@@ -167,7 +214,12 @@ func main() {
 
 	log.Printf("Using handlers-dir %s", absHandlersDir)
 
-	r.AddHandler(&EventRouter{totalMessages: *totalMessages, handlersDir: absHandlersDir})
+	manifest, err := loadHandlerManifest(absHandlersDir)
+	if err != nil {
+		log.Fatalf("failed to load handlers.toml: %s", err.Error())
+	}
+
+	r.AddHandler(&EventRouter{totalMessages: *totalMessages, handlersDir: absHandlersDir, manifest: manifest})
 
 	for _, addrString := range nsqdTCPAddrs {
 		err := r.ConnectToNSQ(addrString)
@@ -8,31 +8,40 @@ import (
   "io/ioutil"
   "bytes"
   "os"
+  "strconv"
   "strings"
+  "time"
+
+  "github.com/davidpelaez/nsq-events/journal"
 )
 
 var (
   topic         = flag.String("topic", "", "nsq topic")
   nsqdHTTPAddrs  = flag.String("nsqd-http-address", "", "nsqd HTTP address")
+  journalDir     = flag.String("journal", "", "directory of a local write-ahead-log to append events to (enables durability when nsqd is unreachable)")
 )
 
 func failWithUsage() {
-  flags := "[--topic=events] [--nsqd-http-address=127.0.0.1:4151]"
+  flags := "[--topic=events] [--nsqd-http-address=127.0.0.1:4151] [--journal=/var/lib/nsq-events/wal]"
   arguments := "<event_name> [<event_body>]"
   fmt.Println("e.g: nsq_trigger", flags, arguments)
+  fmt.Println("e.g: nsq_trigger replay --topic=events --journal=/var/lib/nsq-events/wal --from=<seq>")
+  fmt.Println("e.g: nsq_trigger tail --topic=events --journal=/var/lib/nsq-events/wal --follow")
   os.Exit(1)
 }
 
 func main() {
-
-  
+  if len(os.Args) > 1 && (os.Args[1] == "replay" || os.Args[1] == "tail") {
+    runJournalCommand(os.Args[1], os.Args[2:])
+    return
+  }
 
   flag.Parse()
 
   if len(flag.Args()) == 0 {
   	fmt.Println("At least the event name is required as non-flag argument")
   	failWithUsage()
-  	
+
   	os.Exit(1)
   }
 
@@ -46,6 +55,22 @@ func main() {
     *nsqdHTTPAddrs = "127.0.0.1:4151"
   }
 
+  var j *journal.Journal
+  if *journalDir != "" {
+    var err error
+    j, err = journal.Open(*journalDir, journal.DefaultSegmentBytes)
+    if err != nil {
+      fmt.Println("failed to open journal:", err.Error())
+      os.Exit(1)
+    }
+  }
+
+  if j != nil {
+    if _, err := j.Append(*topic, []byte(eventBody)); err != nil {
+      fmt.Println("failed to append to journal:", err.Error())
+    }
+  }
+
   url := "http://" + *nsqdHTTPAddrs + "/put?topic=" + *topic
 
   body := bytes.NewBuffer([]byte(eventBody))
@@ -54,3 +79,83 @@ func main() {
   fmt.Println(*nsqdHTTPAddrs + ":",string(response))
 
 }
+
+// runJournalCommand implements the `replay` and `tail` subcommands, which
+// read previously journaled events back out and re-POST them to nsqd.
+func runJournalCommand(cmd string, args []string) {
+  fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+  cmdTopic := fs.String("topic", "events", "nsq topic")
+  cmdNsqdHTTPAddrs := fs.String("nsqd-http-address", "127.0.0.1:4151", "nsqd HTTP address")
+  cmdJournalDir := fs.String("journal", "", "directory of the write-ahead-log to read from")
+  from := fs.Uint64("from", 0, "sequence number to start replaying from (replay only)")
+  follow := fs.Bool("follow", false, "keep tailing for new events as they're journaled (tail only)")
+  fs.Parse(args)
+
+  if *cmdJournalDir == "" {
+    fmt.Println("--journal is required")
+    os.Exit(1)
+  }
+
+  j, err := journal.Open(*cmdJournalDir, journal.DefaultSegmentBytes)
+  if err != nil {
+    fmt.Println("failed to open journal:", err.Error())
+    os.Exit(1)
+  }
+
+  postToNSQD := func(rec *journal.Record) error {
+    url := "http://" + *cmdNsqdHTTPAddrs + "/put?topic=" + *cmdTopic
+    r, err := http.Post(url, "text/plain", bytes.NewBuffer(rec.Body))
+    if err != nil {
+      return err
+    }
+    response, _ := ioutil.ReadAll(r.Body)
+    fmt.Println(strconv.FormatUint(rec.Seq, 10)+":", *cmdNsqdHTTPAddrs+":", string(response))
+    return nil
+  }
+
+  switch cmd {
+  case "replay":
+    records, err := j.ReadFrom(*cmdTopic, *from)
+    if err != nil {
+      fmt.Println("failed to replay journal:", err.Error())
+      os.Exit(1)
+    }
+    for _, rec := range records {
+      if err := postToNSQD(rec); err != nil {
+        fmt.Println("failed to re-POST sequence", rec.Seq, "-", err.Error())
+      }
+    }
+  case "tail":
+    if !*follow {
+      records, err := j.ReadFrom(*cmdTopic, *from)
+      if err != nil {
+        fmt.Println("failed to read journal:", err.Error())
+        os.Exit(1)
+      }
+      for _, rec := range records {
+        if err := postToNSQD(rec); err != nil {
+          fmt.Println("failed to re-POST sequence", rec.Seq, "-", err.Error())
+        }
+      }
+      return
+    }
+
+    stopChan := make(chan struct{})
+    recordChan, errChan := j.Tail(*cmdTopic, *from, 250*time.Millisecond, stopChan)
+    for {
+      select {
+      case rec, ok := <-recordChan:
+        if !ok {
+          return
+        }
+        if err := postToNSQD(rec); err != nil {
+          fmt.Println("failed to re-POST sequence", rec.Seq, "-", err.Error())
+        }
+      case err := <-errChan:
+        fmt.Println("failed to tail journal:", err.Error())
+        close(stopChan)
+        os.Exit(1)
+      }
+    }
+  }
+}